@@ -0,0 +1,51 @@
+package lecho
+
+import (
+	"strings"
+	"unicode"
+)
+
+var knownBots = []string{
+	"googlebot",
+	"bingbot",
+	"yandexbot",
+	"duckduckbot",
+	"baiduspider",
+	"slurp",
+	"applebot",
+	"facebookexternalhit",
+	"twitterbot",
+	"linkedinbot",
+	"ahrefsbot",
+	"semrushbot",
+	"petalbot",
+	"mj12bot",
+	"dotbot",
+	"amazonbot",
+	"bytespider",
+	"bot",
+	"crawler",
+	"spider",
+}
+
+// DefaultBotDetector detects common crawlers by their User-Agent and returns the matched bot name.
+// Names match whole words only, so devices such as "CUBOT" are not taken for bots.
+func DefaultBotDetector(ua string) (string, bool) {
+	words := make(map[string]struct{})
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(ua), isWordSeparator) {
+		words[word] = struct{}{}
+	}
+
+	for _, name := range knownBots {
+		if _, found := words[name]; found {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
@@ -0,0 +1,35 @@
+package lecho_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestDefaultBotDetector(t *testing.T) {
+	name, isBot := lecho.DefaultBotDetector("Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
+
+	assert.True(t, isBot)
+	assert.Equal(t, "googlebot", name)
+
+	name, isBot = lecho.DefaultBotDetector("Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36")
+
+	assert.False(t, isBot)
+	assert.Empty(t, name)
+
+	for ua, expected := range map[string]string{
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)":             "bingbot",
+		"Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)": "baiduspider",
+		"Mozilla/5.0 (compatible; Yahoo! Slurp; http://help.yahoo.com/help/us/ysearch/slurp)": "slurp",
+		"my-crawler/1.0": "crawler",
+		"Mozilla/5.0 (Linux; Android 10; CUBOT_X30) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36": "",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Robotics/1.0":   "",
+	} {
+		name, isBot := lecho.DefaultBotDetector(ua)
+
+		assert.Equal(t, expected, name, ua)
+		assert.Equal(t, expected != "", isBot, ua)
+	}
+}
@@ -0,0 +1,61 @@
+package lecho
+
+import (
+	"runtime/debug"
+)
+
+// Field names used by WithBuildInfo and WithVCSInfo.
+const (
+	VersionFieldName   = "version"
+	CommitFieldName    = "commit"
+	BuildDateFieldName = "build_date"
+)
+
+// WithBuildInfo tags every record with the version, commit and build date of the binary,
+// e.g. set with -ldflags "-X main.version=...". Empty values are omitted.
+// The fields are not prefixed by WithFieldPrefix.
+func WithBuildInfo(version, commit, buildDate string) Setter {
+	return func(opts *Options) {
+		for _, f := range [...]struct{ name, value string }{
+			{VersionFieldName, version},
+			{CommitFieldName, commit},
+			{BuildDateFieldName, buildDate},
+		} {
+			if f.value != "" {
+				withField(f.name, f.value)(opts)
+			}
+		}
+	}
+}
+
+// WithVCSInfo is like WithBuildInfo, but takes the module version, the VCS revision and the VCS time
+// from the build info embedded by the go command. Nothing is added if the build info is unavailable.
+func WithVCSInfo() Setter {
+	info, _ := debug.ReadBuildInfo()
+
+	return WithVCSInfoFrom(info)
+}
+
+// WithVCSInfoFrom is like WithVCSInfo, but uses the given build info, e.g. read from another binary.
+func WithVCSInfoFrom(info *debug.BuildInfo) Setter {
+	if info == nil {
+		return func(opts *Options) {}
+	}
+
+	var version, commit, buildDate string
+
+	if info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			commit = s.Value
+		case "vcs.time":
+			buildDate = s.Value
+		}
+	}
+
+	return WithBuildInfo(version, commit, buildDate)
+}
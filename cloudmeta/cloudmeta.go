@@ -0,0 +1,199 @@
+// Package cloudmeta discovers the region and zone of a cloud instance from its metadata server.
+package cloudmeta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+var (
+	// GCPEndpoint is the base URL of the GCP metadata server.
+	GCPEndpoint = "http://metadata.google.internal"
+	// AWSEndpoint is the base URL of the AWS instance metadata service.
+	AWSEndpoint = "http://169.254.169.254"
+	// AzureEndpoint is the base URL of the Azure instance metadata service.
+	AzureEndpoint = "http://169.254.169.254"
+	// Timeout is the maximum time spent querying the metadata servers.
+	Timeout = 500 * time.Millisecond
+)
+
+// Metadata is the location of the instance.
+type Metadata struct {
+	Region string
+	Zone   string
+}
+
+type provider func(ctx context.Context, client *http.Client) (Metadata, error)
+
+var errNoMetadata = errors.New("no metadata")
+
+// WithCloudMetadata returns a setter attaching region and zone fields discovered from the metadata server.
+// Discovery happens once, when WithCloudMetadata is called.
+// If no metadata server is available, the returned setter does nothing.
+func WithCloudMetadata(ctx context.Context) lecho.Setter {
+	md, ok := Discover(ctx)
+
+	if !ok {
+		return func(opts *lecho.Options) {}
+	}
+
+	fields := make(map[string]interface{}, 2)
+
+	if md.Region != "" {
+		fields["region"] = md.Region
+	}
+
+	if md.Zone != "" {
+		fields["zone"] = md.Zone
+	}
+
+	return lecho.WithFields(fields)
+}
+
+// Discover queries GCP, AWS and Azure metadata servers concurrently and returns the first metadata found,
+// preferring providers in that order.
+func Discover(ctx context.Context) (Metadata, bool) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	providers := []provider{gcp, aws, azure}
+	results := make([]Metadata, len(providers))
+	errs := make([]error, len(providers))
+	client := &http.Client{}
+
+	var wg sync.WaitGroup
+
+	for i, p := range providers {
+		wg.Add(1)
+
+		go func(i int, p provider) {
+			defer wg.Done()
+
+			results[i], errs[i] = p(ctx, client)
+		}(i, p)
+	}
+
+	wg.Wait()
+
+	for i, md := range results {
+		if errs[i] == nil && (md.Region != "" || md.Zone != "") {
+			return md, true
+		}
+	}
+
+	return Metadata{}, false
+}
+
+func gcp(ctx context.Context, client *http.Client) (Metadata, error) {
+	header := http.Header{"Metadata-Flavor": []string{"Google"}}
+
+	// projects/<project-number>/zones/<zone>
+	zone, err := fetch(ctx, client, http.MethodGet, GCPEndpoint+"/computeMetadata/v1/instance/zone", header)
+
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	zone = zone[strings.LastIndex(zone, "/")+1:]
+
+	if zone == "" {
+		return Metadata{}, errNoMetadata
+	}
+
+	md := Metadata{Zone: zone}
+
+	// <region>-<zone suffix>
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		md.Region = zone[:i]
+	}
+
+	return md, nil
+}
+
+func aws(ctx context.Context, client *http.Client) (Metadata, error) {
+	header := http.Header{}
+
+	// IMDSv2 requires a session token, fallback to IMDSv1 otherwise
+	token, err := fetch(ctx, client, http.MethodPut, AWSEndpoint+"/latest/api/token", http.Header{
+		"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": []string{"60"},
+	})
+
+	if err == nil {
+		header.Set("X-Aws-Ec2-Metadata-Token", token)
+	} else if ctx.Err() != nil {
+		return Metadata{}, err
+	}
+
+	zone, err := fetch(ctx, client, http.MethodGet, AWSEndpoint+"/latest/meta-data/placement/availability-zone", header)
+
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	region, err := fetch(ctx, client, http.MethodGet, AWSEndpoint+"/latest/meta-data/placement/region", header)
+
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return Metadata{Region: region, Zone: zone}, nil
+}
+
+func azure(ctx context.Context, client *http.Client) (Metadata, error) {
+	header := http.Header{"Metadata": []string{"true"}}
+
+	body, err := fetch(ctx, client, http.MethodGet, AzureEndpoint+"/metadata/instance/compute?api-version=2021-02-01", header)
+
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	var compute struct {
+		Location string `json:"location"`
+		Zone     string `json:"zone"`
+	}
+
+	if err := json.Unmarshal([]byte(body), &compute); err != nil {
+		return Metadata{}, err
+	}
+
+	return Metadata{Region: compute.Location, Zone: compute.Zone}, nil
+}
+
+func fetch(ctx context.Context, client *http.Client, method, url string, header http.Header) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+
+	if err != nil {
+		return "", err
+	}
+
+	req.Header = header
+
+	res, err := client.Do(req)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", errNoMetadata
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,117 @@
+package cloudmeta_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+	"github.com/ziflex/lecho/v3/cloudmeta"
+)
+
+func useEndpoints(t *testing.T, gcp, aws, azure string) {
+	prevGCP, prevAWS, prevAzure := cloudmeta.GCPEndpoint, cloudmeta.AWSEndpoint, cloudmeta.AzureEndpoint
+
+	cloudmeta.GCPEndpoint, cloudmeta.AWSEndpoint, cloudmeta.AzureEndpoint = gcp, aws, azure
+
+	t.Cleanup(func() {
+		cloudmeta.GCPEndpoint, cloudmeta.AWSEndpoint, cloudmeta.AzureEndpoint = prevGCP, prevAWS, prevAzure
+	})
+}
+
+func TestWithCloudMetadata(t *testing.T) {
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	t.Run("GCP", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/computeMetadata/v1/instance/zone" || r.Header.Get("Metadata-Flavor") != "Google" {
+				http.NotFound(w, r)
+
+				return
+			}
+
+			w.Write([]byte("projects/123/zones/us-central1-a"))
+		}))
+		defer srv.Close()
+
+		useEndpoints(t, srv.URL, notFound.URL, notFound.URL)
+
+		b := &bytes.Buffer{}
+		l := lecho.New(b, cloudmeta.WithCloudMetadata(context.Background()))
+		l.Info("foo")
+
+		assert.Equal(t, `{"level":"info","region":"us-central1","zone":"us-central1-a","message":"foo"}`+"\n", b.String())
+	})
+
+	t.Run("AWS", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+				w.Write([]byte("token"))
+
+				return
+			}
+
+			if r.Header.Get("X-Aws-Ec2-Metadata-Token") != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			switch r.URL.Path {
+			case "/latest/meta-data/placement/availability-zone":
+				w.Write([]byte("eu-west-1b"))
+			case "/latest/meta-data/placement/region":
+				w.Write([]byte("eu-west-1"))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer srv.Close()
+
+		useEndpoints(t, notFound.URL, srv.URL, notFound.URL)
+
+		b := &bytes.Buffer{}
+		l := lecho.New(b, cloudmeta.WithCloudMetadata(context.Background()))
+		l.Info("foo")
+
+		assert.Equal(t, `{"level":"info","region":"eu-west-1","zone":"eu-west-1b","message":"foo"}`+"\n", b.String())
+	})
+
+	t.Run("Azure", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/metadata/instance/compute" || r.Header.Get("Metadata") != "true" {
+				http.NotFound(w, r)
+
+				return
+			}
+
+			w.Write([]byte(`{"location":"westeurope","zone":"2"}`))
+		}))
+		defer srv.Close()
+
+		useEndpoints(t, notFound.URL, notFound.URL, srv.URL)
+
+		b := &bytes.Buffer{}
+		l := lecho.New(b, cloudmeta.WithCloudMetadata(context.Background()))
+		l.Info("foo")
+
+		assert.Equal(t, `{"level":"info","region":"westeurope","zone":"2","message":"foo"}`+"\n", b.String())
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		closed := httptest.NewServer(http.NotFoundHandler())
+		closed.Close()
+
+		useEndpoints(t, closed.URL, notFound.URL, closed.URL)
+
+		b := &bytes.Buffer{}
+		l := lecho.New(b, cloudmeta.WithCloudMetadata(context.Background()))
+		l.Info("foo")
+
+		assert.Equal(t, `{"level":"info","message":"foo"}`+"\n", b.String())
+	})
+}
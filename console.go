@@ -0,0 +1,90 @@
+package lecho
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Output formats used by Logger.SetFormat.
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+)
+
+const (
+	colorRed     = 31
+	colorGreen   = 32
+	colorYellow  = 33
+	colorMagenta = 35
+	colorBold    = 1
+)
+
+type consoleLevel struct {
+	abbr  string
+	color int
+	bold  bool
+}
+
+// consoleLevels mirrors the default level formatting of zerolog.ConsoleWriter.
+var consoleLevels = map[zerolog.Level]consoleLevel{
+	zerolog.TraceLevel: {"TRC", colorMagenta, false},
+	zerolog.DebugLevel: {"DBG", colorYellow, false},
+	zerolog.InfoLevel:  {"INF", colorGreen, false},
+	zerolog.WarnLevel:  {"WRN", colorRed, false},
+	zerolog.ErrorLevel: {"ERR", colorRed, true},
+	zerolog.FatalLevel: {"FTL", colorRed, true},
+	zerolog.PanicLevel: {"PNC", colorRed, true},
+}
+
+// newConsoleWriter returns a zerolog.ConsoleWriter writing to out with the given level colors.
+func newConsoleWriter(out io.Writer, colors map[zerolog.Level]int) zerolog.ConsoleWriter {
+	return zerolog.ConsoleWriter{
+		Out:         out,
+		FormatLevel: formatConsoleLevel(colors),
+	}
+}
+
+func formatConsoleLevel(colors map[zerolog.Level]int) zerolog.Formatter {
+	return func(i interface{}) string {
+		name, ok := i.(string)
+
+		if !ok {
+			if i == nil {
+				return colorize("???", colorBold)
+			}
+
+			return strings.ToUpper(fmt.Sprintf("%s", i))[0:3]
+		}
+
+		level, err := zerolog.ParseLevel(name)
+
+		if err != nil {
+			return colorize(name, colorBold)
+		}
+
+		cl, found := consoleLevels[level]
+
+		if !found {
+			return colorize(name, colorBold)
+		}
+
+		if color, found := colors[level]; found {
+			return colorize(cl.abbr, color)
+		}
+
+		s := colorize(cl.abbr, cl.color)
+
+		if cl.bold {
+			s = colorize(s, colorBold)
+		}
+
+		return s
+	}
+}
+
+func colorize(s string, color int) string {
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
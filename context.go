@@ -2,12 +2,14 @@ package lecho
 
 import (
 	"context"
+	"os"
 
+	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog"
 )
 
 // WithContext returns a new context with the provided logger.
-func (l Logger) WithContext(ctx context.Context) context.Context {
+func (l *Logger) WithContext(ctx context.Context) context.Context {
 	zerologger := l.Unwrap()
 	return zerologger.WithContext(ctx)
 }
@@ -17,3 +19,38 @@ func (l Logger) WithContext(ctx context.Context) context.Context {
 func Ctx(ctx context.Context) *zerolog.Logger {
 	return zerolog.Ctx(ctx)
 }
+
+// LoggerFromEchoContext returns a logger from the provided echo context.
+// It returns the logger set by the middleware or, failing that, a logger built from the request context,
+// which carries the request fields, and then the logger of echo, e.g. when the context was not wrapped.
+// If no logger is found, a new one is created.
+func LoggerFromEchoContext(c echo.Context) *Logger {
+	if ctx, ok := c.(*Context); ok {
+		return ctx.logger
+	}
+
+	if zl := zerolog.Ctx(c.Request().Context()); zl.GetLevel() != zerolog.Disabled {
+		return From(*zl)
+	}
+
+	if l, ok := c.Logger().(*Logger); ok {
+		return l
+	}
+
+	return New(os.Stdout, WithTimestamp())
+}
+
+type http2StreamKey struct{}
+
+// WithHTTP2StreamID returns a new context with the HTTP/2 stream ID of the request, logged by the middleware with Config.LogHTTP2Stream.
+// net/http does not expose stream IDs, so it is meant for servers or transports that know them.
+func WithHTTP2StreamID(ctx context.Context, id uint32) context.Context {
+	return context.WithValue(ctx, http2StreamKey{}, id)
+}
+
+// HTTP2StreamID returns the HTTP/2 stream ID set by WithHTTP2StreamID, if any.
+func HTTP2StreamID(ctx context.Context) (uint32, bool) {
+	id, ok := ctx.Value(http2StreamKey{}).(uint32)
+
+	return id, ok
+}
@@ -3,8 +3,11 @@ package lecho_test
 import (
 	"bytes"
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/ziflex/lecho/v3"
@@ -18,3 +21,61 @@ func TestCtx(t *testing.T) {
 
 	assert.Equal(t, lecho.Ctx(ctx), &zerologger)
 }
+
+func TestLoggerFromEchoContext(t *testing.T) {
+	t.Run("should return logger from wrapped context", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		l := lecho.New(&bytes.Buffer{})
+		c := lecho.NewContext(e.NewContext(req, httptest.NewRecorder()), l)
+
+		assert.Same(t, l, lecho.LoggerFromEchoContext(c))
+	})
+
+	t.Run("should return logger from request context", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithField("key", "test"))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(l.WithContext(req.Context()))
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		lecho.LoggerFromEchoContext(c).Print("foo")
+
+		assert.Equal(t, `{"key":"test","level":"-","message":"foo"}
+`, b.String())
+	})
+
+	t.Run("should prefer the request context to the logger of echo", func(t *testing.T) {
+		e := echo.New()
+		e.Logger = lecho.New(&bytes.Buffer{})
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithField("req", "test"))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(l.WithContext(req.Context()))
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		lecho.LoggerFromEchoContext(c).Print("foo")
+
+		assert.Equal(t, `{"req":"test","level":"-","message":"foo"}
+`, b.String())
+	})
+
+	t.Run("should return the logger of echo", func(t *testing.T) {
+		e := echo.New()
+		l := lecho.New(&bytes.Buffer{})
+		e.Logger = l
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		assert.Same(t, l, lecho.LoggerFromEchoContext(c))
+	})
+
+	t.Run("should return default logger", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		assert.NotNil(t, lecho.LoggerFromEchoContext(c))
+	})
+}
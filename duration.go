@@ -0,0 +1,38 @@
+package lecho
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatISO8601Duration returns an ISO8601 representation of a given duration, e.g. PT1M30.5S
+func FormatISO8601Duration(d time.Duration) string {
+	var sb strings.Builder
+
+	if d < 0 {
+		sb.WriteByte('-')
+		d = -d
+	}
+
+	sb.WriteString("PT")
+
+	if h := d / time.Hour; h > 0 {
+		sb.WriteString(strconv.FormatInt(int64(h), 10))
+		sb.WriteByte('H')
+		d -= h * time.Hour
+	}
+
+	if m := d / time.Minute; m > 0 {
+		sb.WriteString(strconv.FormatInt(int64(m), 10))
+		sb.WriteByte('M')
+		d -= m * time.Minute
+	}
+
+	if d > 0 || sb.Len() <= 3 {
+		sb.WriteString(strconv.FormatFloat(d.Seconds(), 'f', -1, 64))
+		sb.WriteByte('S')
+	}
+
+	return sb.String()
+}
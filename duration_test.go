@@ -0,0 +1,27 @@
+package lecho_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestFormatISO8601Duration(t *testing.T) {
+	cases := map[time.Duration]string{
+		0:                                     "PT0S",
+		123 * time.Millisecond:                "PT0.123S",
+		1500 * time.Microsecond:               "PT0.0015S",
+		5 * time.Second:                       "PT5S",
+		90*time.Second + 500*time.Millisecond: "PT1M30.5S",
+		time.Hour + time.Minute + time.Second: "PT1H1M1S",
+		2 * time.Hour:                         "PT2H",
+		-250 * time.Millisecond:               "-PT0.25S",
+	}
+
+	for d, expected := range cases {
+		assert.Equal(t, expected, lecho.FormatISO8601Duration(d), d.String())
+	}
+}
@@ -0,0 +1,217 @@
+// Package elasticsearch indexes records in Elasticsearch with bulk requests through any Elasticsearch client.
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ziflex/lecho/v3"
+	"github.com/ziflex/lecho/v3/internal/queue"
+)
+
+// ESClient sends a bulk request with the given NDJSON body and returns the body of the response.
+// It is implemented by a thin adapter over an Elasticsearch client.
+type ESClient interface {
+	Bulk(ctx context.Context, body []byte) ([]byte, error)
+}
+
+// Option configures a Writer.
+type Option func(opts *options)
+
+type options struct {
+	batchSize      int
+	flushInterval  time.Duration
+	queueSize      int
+	fallback       io.Writer
+	requestTimeout time.Duration
+	flushTimeout   time.Duration
+}
+
+// WithBatchSize sets the number of records sent in a bulk request. Defaults to 500.
+func WithBatchSize(size int) Option {
+	return func(opts *options) {
+		opts.batchSize = size
+	}
+}
+
+// WithFlushInterval sets the maximum time records wait before being sent. Defaults to 1 second.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(opts *options) {
+		opts.flushInterval = interval
+	}
+}
+
+// WithQueueSize sets the number of records waiting to be sent, beyond which new records are dropped. Defaults to 4096.
+func WithQueueSize(size int) Option {
+	return func(opts *options) {
+		opts.queueSize = size
+	}
+}
+
+// WithFallback sets the writer receiving the records that failed to be indexed. Defaults to os.Stderr.
+func WithFallback(w io.Writer) Option {
+	return func(opts *options) {
+		opts.fallback = w
+	}
+}
+
+// WithRequestTimeout sets the deadline of the context of each bulk request. Defaults to 10 seconds.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.requestTimeout = timeout
+	}
+}
+
+// WithFlushTimeout sets the maximum time Flush and Close wait for the queued records. Defaults to 30 seconds.
+// Zero waits indefinitely.
+func WithFlushTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.flushTimeout = timeout
+	}
+}
+
+// bulkResponse is the part of the bulk response used to find the failed records.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Error json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// Writer sends records asynchronously, so logging does not block on Elasticsearch.
+type Writer struct {
+	client   ESClient
+	action   []byte
+	fallback io.Writer
+	q        *queue.Queue
+}
+
+// NewWriter returns a Writer indexing each record in the index.
+// Records are sent by a background goroutine, started by NewWriter and stopped by Close,
+// in bulk requests of the batch size, or every flush interval.
+// When the queue is full, records are dropped rather than blocking the caller.
+// Records that failed to be indexed are written to the fallback.
+func NewWriter(client ESClient, index string, opts ...Option) *Writer {
+	o := options{
+		batchSize:      500,
+		flushInterval:  time.Second,
+		queueSize:      4096,
+		fallback:       os.Stderr,
+		requestTimeout: 10 * time.Second,
+		flushTimeout:   30 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	action, _ := json.Marshal(map[string]interface{}{
+		"index": map[string]string{"_index": index},
+	})
+
+	w := &Writer{
+		client:   client,
+		action:   append(action, '\n'),
+		fallback: o.fallback,
+	}
+
+	w.q = queue.New(queue.Config{
+		Size:         o.queueSize,
+		BatchSize:    o.batchSize,
+		Interval:     o.flushInterval,
+		Timeout:      o.requestTimeout,
+		FlushTimeout: o.flushTimeout,
+	}, w.send)
+
+	return w
+}
+
+// WithElasticsearchWriter returns a setter indexing each record in the index, in addition to the output.
+// Logger.Flush and Logger.Close wait until the queued records are sent.
+// The goroutine of the writer runs for the lifetime of the process,
+// use NewWriter with lecho.WithWriter instead to be able to close it.
+func WithElasticsearchWriter(client ESClient, index string, opts ...Option) lecho.Setter {
+	return lecho.WithWriter(NewWriter(client, index, opts...))
+}
+
+// Write queues the record. It never blocks nor fails.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.q.Write(p)
+}
+
+// Flush waits until the queued records are sent.
+func (w *Writer) Flush() error {
+	return w.q.Flush()
+}
+
+// Close sends the queued records, stops the background goroutine and returns the last error of a bulk request.
+func (w *Writer) Close() error {
+	return w.q.Close()
+}
+
+// Dropped returns the number of records dropped because the queue was full or the writer closed.
+func (w *Writer) Dropped() uint64 {
+	return w.q.Dropped()
+}
+
+// send sends the batch in a bulk request.
+func (w *Writer) send(ctx context.Context, batch [][]byte) error {
+	body := &bytes.Buffer{}
+
+	for _, record := range batch {
+		body.Write(w.action)
+		body.Write(bytes.TrimRight(record, "\n"))
+		body.WriteByte('\n')
+	}
+
+	res, err := w.client.Bulk(ctx, body.Bytes())
+
+	var r bulkResponse
+
+	if err == nil {
+		err = json.Unmarshal(res, &r)
+	}
+
+	failed := 0
+
+	for i, record := range batch {
+		if err != nil || r.failed(i) {
+			failed++
+			_, _ = w.fallback.Write(record)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records failed to be indexed", failed, len(batch))
+	}
+
+	return nil
+}
+
+// failed reports whether the ith record of the bulk request failed to be indexed.
+func (r bulkResponse) failed(i int) bool {
+	if !r.Errors {
+		return false
+	}
+
+	if i >= len(r.Items) {
+		return true
+	}
+
+	for _, item := range r.Items[i] {
+		if len(item.Error) > 0 && string(item.Error) != "null" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,159 @@
+package elasticsearch_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+	"github.com/ziflex/lecho/v3/elasticsearch"
+)
+
+type fakeClient struct {
+	mu       sync.Mutex
+	bodies   []string
+	response string
+	err      error
+}
+
+func (c *fakeClient) Bulk(ctx context.Context, body []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bodies = append(c.bodies, string(body))
+
+	return []byte(c.response), c.err
+}
+
+func (c *fakeClient) requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.bodies...)
+}
+
+func TestWithElasticsearchWriter(t *testing.T) {
+	t.Run("should send bulk requests on flush", func(t *testing.T) {
+		fallback := &bytes.Buffer{}
+		c := &fakeClient{response: `{"errors":false,"items":[{"index":{"status":201}},{"index":{"status":201}}]}`}
+		b := &bytes.Buffer{}
+		l := lecho.New(b, elasticsearch.WithElasticsearchWriter(c, "logs", elasticsearch.WithFallback(fallback)))
+
+		l.Info("foo")
+		l.Warn("bar")
+
+		assert.NoError(t, l.Flush())
+		assert.Equal(t, []string{`{"index":{"_index":"logs"}}
+{"level":"info","message":"foo"}
+{"index":{"_index":"logs"}}
+{"level":"warn","message":"bar"}
+`}, c.requests())
+		assert.Empty(t, fallback.String())
+		assert.Contains(t, b.String(), "foo", "should write to the output too")
+
+		assert.NoError(t, l.Flush())
+		assert.Len(t, c.requests(), 1, "should not send empty requests")
+	})
+
+	t.Run("should send bulk requests when the batch is full", func(t *testing.T) {
+		c := &fakeClient{response: `{"errors":false}`}
+		l := lecho.New(io.Discard, elasticsearch.WithElasticsearchWriter(c, "logs", elasticsearch.WithBatchSize(2)))
+
+		l.Info("foo")
+		l.Info("bar")
+		l.Info("baz")
+
+		assert.Eventually(t, func() bool {
+			return len(c.requests()) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		assert.NoError(t, l.Close())
+
+		if requests := c.requests(); assert.Len(t, requests, 2, "should flush on close") {
+			assert.Contains(t, requests[1], "baz")
+		}
+	})
+
+	t.Run("should write failed records to the fallback", func(t *testing.T) {
+		fallback := &bytes.Buffer{}
+		c := &fakeClient{response: `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`}
+		w := elasticsearch.NewWriter(c, "logs", elasticsearch.WithFallback(fallback))
+		l := lecho.New(io.Discard, lecho.WithWriter(w))
+
+		l.Info("foo")
+		l.Info("bar")
+
+		assert.NoError(t, l.Flush())
+		assert.Equal(t, `{"level":"info","message":"bar"}
+`, fallback.String())
+
+		fallback.Reset()
+		c.err = errors.New("unavailable")
+		l.Info("baz")
+
+		assert.NoError(t, l.Flush())
+		assert.Equal(t, 1, strings.Count(fallback.String(), "baz"), "should write the whole batch if the request fails")
+		assert.Equal(t, c.err, w.Close(), "should return the last error on close")
+	})
+
+	t.Run("should send the queued records on close", func(t *testing.T) {
+		c := &fakeClient{response: `{"errors":false}`}
+		w := elasticsearch.NewWriter(c, "logs", elasticsearch.WithFlushInterval(time.Hour))
+		l := lecho.New(io.Discard, lecho.WithWriter(w))
+
+		l.Info("foo")
+
+		assert.NoError(t, w.Close())
+		assert.Len(t, c.requests(), 1)
+
+		l.Info("bar")
+
+		assert.NoError(t, l.Flush())
+		assert.Len(t, c.requests(), 1, "should drop records after close")
+		assert.Equal(t, uint64(1), w.Dropped())
+	})
+
+	t.Run("should send bulk requests with a deadline", func(t *testing.T) {
+		c := &blockingClient{}
+		fallback := &bytes.Buffer{}
+		l := lecho.New(io.Discard, elasticsearch.WithElasticsearchWriter(c, "logs",
+			elasticsearch.WithFallback(fallback),
+			elasticsearch.WithRequestTimeout(10*time.Millisecond),
+		))
+
+		l.Info("foo")
+
+		assert.NoError(t, l.Flush())
+		assert.Contains(t, fallback.String(), "foo", "should write the records of the timed out request to the fallback")
+	})
+
+	t.Run("should stop waiting after the flush timeout", func(t *testing.T) {
+		c := &blockingClient{}
+		w := elasticsearch.NewWriter(c, "logs",
+			elasticsearch.WithFallback(io.Discard),
+			elasticsearch.WithRequestTimeout(time.Second),
+			elasticsearch.WithFlushTimeout(10*time.Millisecond),
+		)
+		l := lecho.New(io.Discard, lecho.WithWriter(w))
+
+		l.Info("foo")
+
+		assert.Error(t, l.Flush())
+		assert.Error(t, w.Close())
+	})
+}
+
+// blockingClient blocks until the deadline of the request.
+type blockingClient struct{}
+
+func (blockingClient) Bulk(ctx context.Context, body []byte) ([]byte, error) {
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
@@ -0,0 +1,29 @@
+package lecho
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultGroupExtractor returns the first segment of the matched route, e.g. "/api" for "/api/v1/users/:id",
+// or of the request path if no route matched.
+func DefaultGroupExtractor(c echo.Context) string {
+	path := c.Path()
+
+	if path == "" {
+		path = c.Request().URL.Path
+	}
+
+	path = strings.TrimPrefix(path, "/")
+
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+
+	if path == "" {
+		return ""
+	}
+
+	return "/" + path
+}
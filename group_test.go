@@ -0,0 +1,28 @@
+package lecho_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestDefaultGroupExtractor(t *testing.T) {
+	e := echo.New()
+
+	for path, expected := range map[string]string{
+		"/api/v1/users/:id": "/api",
+		"/admin":            "/admin",
+		"/":                 "",
+		"":                  "/static",
+	} {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/static/app.js", nil), httptest.NewRecorder())
+		c.SetPath(path)
+
+		assert.Equal(t, expected, lecho.DefaultGroupExtractor(c), path)
+	}
+}
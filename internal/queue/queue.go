@@ -0,0 +1,232 @@
+// Package queue sends records asynchronously in batches, so logging does not block on a remote service.
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTimeout is returned by Flush and Close when the queued records are not sent in time.
+var ErrTimeout = errors.New("timed out sending the queued records")
+
+// Config configures a Queue.
+type Config struct {
+	// Size is the number of records waiting to be sent, beyond which new records are dropped.
+	Size int
+	// BatchSize is the number of records sent at once. Defaults to 1.
+	BatchSize int
+	// Interval is the maximum time records wait for the batch to be full. Zero waits until Flush.
+	Interval time.Duration
+	// Timeout is the deadline of the context passed to each send. Zero means no deadline.
+	Timeout time.Duration
+	// FlushTimeout is the maximum time Flush and Close wait for the queued records. Zero waits indefinitely.
+	FlushTimeout time.Duration
+	// OnError is called by the background goroutine with the errors returned by send.
+	OnError func(err error)
+}
+
+// Queue hands the written records to a background goroutine, which sends them in batches.
+type Queue struct {
+	config  Config
+	send    func(ctx context.Context, batch [][]byte) error
+	records chan []byte
+	flush   chan chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+
+	// closed is guarded by mu, so no record is queued once Close started draining
+	mu     sync.RWMutex
+	closed bool
+
+	dropped uint64
+
+	errMu   sync.Mutex
+	lastErr error
+}
+
+// New starts the background goroutine sending the batches with send, which must not retain the batch.
+// The goroutine runs until Close is called.
+func New(config Config, send func(ctx context.Context, batch [][]byte) error) *Queue {
+	if config.BatchSize < 1 {
+		config.BatchSize = 1
+	}
+
+	q := &Queue{
+		config:  config,
+		send:    send,
+		records: make(chan []byte, config.Size),
+		flush:   make(chan chan struct{}),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go q.run()
+
+	return q
+}
+
+// Write queues a copy of p, or drops it if the queue is full or closed. It never blocks nor fails.
+func (q *Queue) Write(p []byte) (int, error) {
+	// p is reused by zerolog after the write
+	record := make([]byte, len(p))
+	copy(record, p)
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		atomic.AddUint64(&q.dropped, 1)
+
+		return len(p), nil
+	}
+
+	select {
+	case q.records <- record:
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+	}
+
+	return len(p), nil
+}
+
+// Flush waits until the queued records are sent, at most FlushTimeout.
+func (q *Queue) Flush() error {
+	timeout := q.timeout()
+	done := make(chan struct{})
+
+	select {
+	case q.flush <- done:
+	case <-q.stopped:
+		return nil
+	case <-timeout:
+		return ErrTimeout
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-timeout:
+		return ErrTimeout
+	}
+}
+
+// Close sends the queued records, stops the background goroutine and returns the last error returned by send.
+// Records written after Close are dropped.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.stopped:
+		return q.err()
+	case <-q.timeout():
+		return ErrTimeout
+	}
+}
+
+// Dropped returns the number of records dropped because the queue was full or closed.
+func (q *Queue) Dropped() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// timeout returns a channel receiving once FlushTimeout elapsed, or never if it is zero.
+func (q *Queue) timeout() <-chan time.Time {
+	if q.config.FlushTimeout <= 0 {
+		return nil
+	}
+
+	return time.After(q.config.FlushTimeout)
+}
+
+func (q *Queue) err() error {
+	q.errMu.Lock()
+	defer q.errMu.Unlock()
+
+	return q.lastErr
+}
+
+func (q *Queue) run() {
+	defer close(q.stopped)
+
+	var tick <-chan time.Time
+
+	if q.config.Interval > 0 {
+		ticker := time.NewTicker(q.config.Interval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	batch := make([][]byte, 0, q.config.BatchSize)
+
+	for {
+		select {
+		case record := <-q.records:
+			batch = q.add(batch, record)
+		case <-tick:
+			batch = q.sendBatch(batch)
+		case done := <-q.flush:
+			batch = q.drain(batch)
+			close(done)
+		case <-q.stop:
+			q.drain(batch)
+
+			return
+		}
+	}
+}
+
+// add appends the record to the batch and sends it if it is full.
+func (q *Queue) add(batch [][]byte, record []byte) [][]byte {
+	if batch = append(batch, record); len(batch) >= q.config.BatchSize {
+		return q.sendBatch(batch)
+	}
+
+	return batch
+}
+
+// drain sends the batch and the queued records.
+func (q *Queue) drain(batch [][]byte) [][]byte {
+	for {
+		select {
+		case record := <-q.records:
+			batch = q.add(batch, record)
+		default:
+			return q.sendBatch(batch)
+		}
+	}
+}
+
+// sendBatch sends the batch and returns it emptied.
+func (q *Queue) sendBatch(batch [][]byte) [][]byte {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx := context.Background()
+
+	if q.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.config.Timeout)
+		defer cancel()
+	}
+
+	if err := q.send(ctx, batch); err != nil {
+		q.errMu.Lock()
+		q.lastErr = err
+		q.errMu.Unlock()
+
+		if q.config.OnError != nil {
+			q.config.OnError(err)
+		}
+	}
+
+	return batch[:0]
+}
@@ -0,0 +1,121 @@
+// Package kafka streams records to a Kafka topic through any Kafka client.
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/ziflex/lecho/v3"
+	"github.com/ziflex/lecho/v3/internal/queue"
+)
+
+// KafkaProducer produces messages to a topic. It is implemented by a thin adapter over a Kafka client.
+type KafkaProducer interface {
+	Produce(topic string, value []byte) error
+}
+
+// Option configures a Writer.
+type Option func(opts *options)
+
+type options struct {
+	queueSize    int
+	flushTimeout time.Duration
+	onError      func(err error)
+}
+
+// WithQueueSize sets the number of records waiting to be produced, beyond which new records are dropped. Defaults to 1024.
+func WithQueueSize(size int) Option {
+	return func(opts *options) {
+		opts.queueSize = size
+	}
+}
+
+// WithFlushTimeout sets the maximum time Flush and Close wait for the queued records. Defaults to 5 seconds.
+// Zero waits indefinitely.
+func WithFlushTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.flushTimeout = timeout
+	}
+}
+
+// WithErrorHandler sets the function called with the errors returned by the producer, which are ignored by default.
+// It is called from the background goroutine, so it must not log through the writer.
+func WithErrorHandler(fn func(err error)) Option {
+	return func(opts *options) {
+		opts.onError = fn
+	}
+}
+
+// Writer produces records asynchronously, so logging does not block on the producer.
+type Writer struct {
+	producer KafkaProducer
+	topic    string
+	q        *queue.Queue
+}
+
+// NewWriter returns a Writer producing each record as a message to the topic.
+// Records are produced by a background goroutine, started by NewWriter and stopped by Close.
+// When the queue is full, records are dropped rather than blocking the caller.
+func NewWriter(producer KafkaProducer, topic string, opts ...Option) *Writer {
+	o := options{
+		queueSize:    1024,
+		flushTimeout: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	w := &Writer{
+		producer: producer,
+		topic:    topic,
+	}
+
+	w.q = queue.New(queue.Config{
+		Size:         o.queueSize,
+		FlushTimeout: o.flushTimeout,
+		OnError:      o.onError,
+	}, w.produce)
+
+	return w
+}
+
+// WithKafkaWriter returns a setter writing each record as a message to the topic, in addition to the output.
+// Logger.Flush waits until the queued records are produced.
+// The goroutine of the writer runs for the lifetime of the process,
+// use NewWriter with lecho.WithWriter instead to be able to close it.
+func WithKafkaWriter(producer KafkaProducer, topic string, opts ...Option) lecho.Setter {
+	return lecho.WithWriter(NewWriter(producer, topic, opts...))
+}
+
+// Write queues the record. It never blocks nor fails.
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.q.Write(p)
+}
+
+// Flush waits until the queued records are produced.
+func (w *Writer) Flush() error {
+	return w.q.Flush()
+}
+
+// Close produces the queued records, stops the background goroutine and returns the last error of the producer.
+func (w *Writer) Close() error {
+	return w.q.Close()
+}
+
+// Dropped returns the number of records dropped because the queue was full or the writer closed.
+func (w *Writer) Dropped() uint64 {
+	return w.q.Dropped()
+}
+
+func (w *Writer) produce(_ context.Context, batch [][]byte) error {
+	var err error
+
+	for _, msg := range batch {
+		if perr := w.producer.Produce(w.topic, msg); perr != nil {
+			err = perr
+		}
+	}
+
+	return err
+}
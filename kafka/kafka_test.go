@@ -0,0 +1,116 @@
+package kafka_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+	"github.com/ziflex/lecho/v3/kafka"
+)
+
+type fakeProducer struct {
+	mu       sync.Mutex
+	topics   []string
+	messages []string
+	block    chan struct{}
+	err      error
+}
+
+func (p *fakeProducer) Produce(topic string, value []byte) error {
+	if p.block != nil {
+		<-p.block
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.topics = append(p.topics, topic)
+	p.messages = append(p.messages, string(value))
+
+	return p.err
+}
+
+func TestWithKafkaWriter(t *testing.T) {
+	t.Run("should produce records to the topic", func(t *testing.T) {
+		p := &fakeProducer{}
+		b := &bytes.Buffer{}
+		l := lecho.New(b, kafka.WithKafkaWriter(p, "logs"))
+
+		l.Info("foo")
+		l.Print("bar")
+
+		assert.NoError(t, l.Flush())
+		assert.Equal(t, []string{"logs", "logs"}, p.topics)
+		assert.Equal(t, []string{
+			`{"level":"info","message":"foo"}` + "\n",
+			`{"level":"-","message":"bar"}` + "\n",
+		}, p.messages)
+		assert.Equal(t, b.String(), p.messages[0]+p.messages[1], "should write to the output too")
+	})
+
+	t.Run("should drop records when the queue is full", func(t *testing.T) {
+		p := &fakeProducer{block: make(chan struct{})}
+		w := kafka.NewWriter(p, "logs", kafka.WithQueueSize(1))
+		l := lecho.New(io.Discard, lecho.WithWriter(w))
+
+		for i := 0; i < 10; i++ {
+			l.Info("foo")
+		}
+
+		close(p.block)
+
+		assert.NoError(t, l.Flush())
+		assert.NotEmpty(t, p.messages)
+		assert.Less(t, len(p.messages), 10, "should not block when the queue is full")
+		assert.Equal(t, uint64(10-len(p.messages)), w.Dropped())
+	})
+
+	t.Run("should report producer errors", func(t *testing.T) {
+		var errs []error
+		p := &fakeProducer{err: errors.New("broker unavailable")}
+		w := kafka.NewWriter(p, "logs", kafka.WithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}))
+		l := lecho.New(io.Discard, lecho.WithWriter(w))
+
+		l.Info("foo")
+		l.Info("bar")
+
+		assert.NoError(t, l.Flush())
+		assert.Equal(t, []error{p.err, p.err}, errs)
+		assert.Equal(t, p.err, w.Close(), "should return the last error on close")
+	})
+
+	t.Run("should produce the queued records on close", func(t *testing.T) {
+		p := &fakeProducer{}
+		w := kafka.NewWriter(p, "logs")
+		l := lecho.New(io.Discard, lecho.WithWriter(w))
+
+		l.Info("foo")
+
+		assert.NoError(t, w.Close())
+		assert.Len(t, p.messages, 1)
+
+		l.Info("bar")
+
+		assert.NoError(t, l.Flush())
+		assert.Len(t, p.messages, 1, "should drop records after close")
+		assert.Equal(t, uint64(1), w.Dropped())
+	})
+
+	t.Run("should stop waiting after the flush timeout", func(t *testing.T) {
+		p := &fakeProducer{block: make(chan struct{})}
+		defer close(p.block)
+
+		l := lecho.New(io.Discard, kafka.WithKafkaWriter(p, "logs", kafka.WithFlushTimeout(10*time.Millisecond)))
+
+		l.Info("foo")
+
+		assert.Error(t, l.Flush())
+	})
+}
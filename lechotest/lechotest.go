@@ -0,0 +1,27 @@
+// Package lechotest provides a lecho logger for tests.
+package lechotest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+// testWriter writes each record to the test log.
+type testWriter struct {
+	t testing.TB
+}
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Helper()
+	w.t.Log(strings.TrimSuffix(string(p), "\n"))
+
+	return len(p), nil
+}
+
+// New returns a new Logger instance writing to t.Log,
+// so records are associated with the test and shown only when it fails or runs verbose.
+func New(t testing.TB, setters ...lecho.Setter) *lecho.Logger {
+	return lecho.New(testWriter{t: t}, setters...)
+}
@@ -0,0 +1,34 @@
+package lechotest_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+	"github.com/ziflex/lecho/v3/lechotest"
+)
+
+type fakeTB struct {
+	testing.TB
+	lines []string
+}
+
+func (tb *fakeTB) Helper() {}
+
+func (tb *fakeTB) Log(args ...interface{}) {
+	tb.lines = append(tb.lines, fmt.Sprint(args...))
+}
+
+func TestNew(t *testing.T) {
+	tb := &fakeTB{TB: t}
+	l := lechotest.New(tb, lecho.WithField("test", true))
+
+	l.Info("foo")
+	l.Warn("bar")
+
+	assert.Equal(t, []string{
+		`{"level":"info","test":true,"message":"foo"}`,
+		`{"level":"warn","test":true,"message":"bar"}`,
+	}, tb.lines)
+}
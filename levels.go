@@ -1,6 +1,10 @@
 package lecho
 
 import (
+	"fmt"
+	"net/http"
+	"strings"
+
 	"github.com/labstack/gommon/log"
 	"github.com/rs/zerolog"
 )
@@ -22,8 +26,29 @@ var (
 		zerolog.ErrorLevel: log.ERROR,
 		zerolog.NoLevel:    log.OFF,
 	}
+
+	levelNames = map[string]log.Lvl{
+		"debug":   log.DEBUG,
+		"info":    log.INFO,
+		"warn":    log.WARN,
+		"warning": log.WARN,
+		"error":   log.ERROR,
+		"off":     log.OFF,
+	}
 )
 
+// ParseLevel returns the echo level for a given case-insensitive level name,
+// or an error if the name is unknown.
+func ParseLevel(name string) (log.Lvl, error) {
+	level, found := levelNames[strings.ToLower(strings.TrimSpace(name))]
+
+	if !found {
+		return log.OFF, fmt.Errorf("unknown level: %q", name)
+	}
+
+	return level, nil
+}
+
 // MatchEchoLevel returns a zerolog level and echo level for a given echo level
 func MatchEchoLevel(level log.Lvl) (zerolog.Level, log.Lvl) {
 	zlvl, found := echoLevels[level]
@@ -45,3 +70,15 @@ func MatchZeroLevel(level zerolog.Level) (log.Lvl, zerolog.Level) {
 
 	return log.OFF, zerolog.NoLevel
 }
+
+// statusLevel returns the level to log an HTTP status at: error for 5xx, warn for 4xx and info otherwise.
+func statusLevel(status int) zerolog.Level {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return zerolog.ErrorLevel
+	case status >= http.StatusBadRequest:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.InfoLevel
+	}
+}
@@ -0,0 +1,29 @@
+package lecho_test
+
+import (
+	"testing"
+
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]log.Lvl{
+		"debug":   log.DEBUG,
+		"INFO":    log.INFO,
+		" warn ":  log.WARN,
+		"Warning": log.WARN,
+		"error":   log.ERROR,
+		"off":     log.OFF,
+	} {
+		level, err := lecho.ParseLevel(name)
+
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, level, name)
+	}
+
+	_, err := lecho.ParseLevel("garbage")
+
+	assert.EqualError(t, err, `unknown level: "garbage"`)
+}
@@ -1,179 +1,942 @@
 package lecho
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-
+	"net"
+	"net/http"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 	"github.com/rs/zerolog"
 )
 
+// LoggerIface is an interface implemented by Logger that callers can depend on to inject fakes.
+type LoggerIface interface {
+	echo.Logger
+	Unwrap() zerolog.Logger
+	WithContext(ctx context.Context) context.Context
+}
+
+var _ LoggerIface = (*Logger)(nil)
+
+// ConditionalLogger is a message that is logged only if the condition it was created with is true.
+// A nil ConditionalLogger is a no-op.
+type ConditionalLogger zerolog.Event
+
+// Msg sends the message if the condition is true.
+func (c *ConditionalLogger) Msg(msg string) {
+	(*zerolog.Event)(c).Msg(msg)
+}
+
+// Msgf sends the formatted message if the condition is true.
+func (c *ConditionalLogger) Msgf(format string, v ...interface{}) {
+	(*zerolog.Event)(c).Msgf(format, v...)
+}
+
+// callSites holds call counters of DebugEvery keyed by the caller program counter.
+var callSites sync.Map
+
+var (
+	// rateSites holds the times of the last emission allowed by EveryN keyed by the caller program counter,
+	// as nanoseconds since rateEpoch plus one, so zero means never.
+	rateSites sync.Map
+	rateEpoch = time.Now()
+	// nopLogger is returned by EveryN when the record is rate limited, so skipped calls do not allocate.
+	nopLogger = From(zerolog.Nop())
+)
+
 // Logger is a wrapper around `zerolog.Logger` that provides an implementation of `echo.Logger` interface
+// It is safe for concurrent use.
+// It must be used through the pointer returned by New or From and must not be copied, use Copy instead.
+// Its methods have pointer receivers, so unlike in earlier v3 releases, a Logger value does not implement echo.Logger.
 type Logger struct {
+	mu      sync.RWMutex
 	log     zerolog.Logger
-	out     io.Writer
+	o       *output
+	w       io.Writer
 	level   log.Lvl
-	prefix  string
 	setters []Setter
-}
+
+	// opts are the options built by the setters when the logger was last rebuilt.
+	// They are shared with the loggers derived from it, so they are replaced rather than modified.
+	opts *Options
+	// slots holds the positions, plus one, of the setters replaced by the setter methods instead of appended
+	slots [slotCount]int
+	// added are the fields added by AddFields, without the field prefix
+	added map[string]interface{}
+
+	// shared is the number of writers in the chain of o, the ones after it wrap o
+	shared int
+	format string
+
+	// untimedLog caches the logger built by untimed, it is reset when the setters or the output change
+	untimedLog *zerolog.Logger
+}
+
+// setter slots of Logger
+const (
+	slotLevel = iota
+	slotPrefix
+	slotName
+	slotCaller
+	slotFields
+	slotCount
+)
 
 // New returns a new Logger instance
 func New(out io.Writer, setters ...Setter) *Logger {
 	switch l := out.(type) {
 	case zerolog.Logger:
-		return newLogger(l, setters)
+		return newLogger(l, nil, setters)
 	default:
-		return newLogger(zerolog.New(out), setters)
+		return newLogger(zerolog.New(out), out, setters)
 	}
 }
 
 // From returns a new Logger instance using existing zerolog log.
 func From(log zerolog.Logger, setters ...Setter) *Logger {
-	return newLogger(log, setters)
+	return newLogger(log, nil, setters)
+}
+
+// BuildZerolog returns a zerolog log configured with the provided setters, without the lecho wrapper.
+func BuildZerolog(out io.Writer, setters ...Setter) zerolog.Logger {
+	return New(out, setters...).Unwrap()
 }
 
-func newLogger(log zerolog.Logger, setters []Setter) *Logger {
+func newLogger(log zerolog.Logger, out io.Writer, setters []Setter) *Logger {
 	opts := newOptions(log, setters)
+	zl := opts.context.Logger()
+
+	var o *output
+	var w io.Writer
+
+	if out != nil {
+		o = newOutput(out, opts.writers, FormatJSON)
+		w = o
+		zl = zl.Output(w)
+	}
 
 	return &Logger{
-		log:     opts.context.Logger(),
-		out:     nil,
+		log:     zl,
+		o:       o,
+		w:       w,
 		level:   opts.level,
-		prefix:  opts.prefix,
-		setters: setters,
+		setters: append([]Setter(nil), setters...),
+
+		opts:  opts,
+		slots: opts.slots,
+
+		shared: len(opts.writers),
+		format: FormatJSON,
+	}
+}
+
+// child returns a new Logger derived from l with the given setters applied.
+func (l *Logger) child(setters ...Setter) *Logger {
+	child := l.clone(setters...)
+	child.rebuild()
+
+	return child
+}
+
+// clone returns a copy of l with the setters of l extended with the given ones.
+// The setters are shared with l, up to its own, and copied by setSetter before being replaced.
+func (l *Logger) clone(setters ...Setter) *Logger {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return &Logger{
+		log:     l.log,
+		o:       l.o,
+		w:       l.w,
+		level:   l.level,
+		setters: append(l.setters[:len(l.setters):len(l.setters)], setters...),
+
+		opts:  l.opts,
+		slots: l.slots,
+		added: l.added,
+
+		shared: l.shared,
+		format: l.format,
 	}
 }
 
-func (l Logger) Debug(i ...interface{}) {
-	l.log.Debug().Msg(fmt.Sprint(i...))
+// derive returns a copy of l with the field added to its context.
+// Unlike child, it does not re-apply the setters, so it is cheap enough to be called for each request.
+func (l *Logger) derive(name string, value interface{}) *Logger {
+	return l.extend(withField(name, value), func(ctx zerolog.Context) zerolog.Context {
+		return ctx.Interface(name, value)
+	})
+}
+
+// extend returns a copy of l with the setter appended and apply, which must change the context the same way, applied to its context.
+// Like derive, it does not re-apply the setters, and the setter is kept so that it is re-applied when the copy is rebuilt.
+func (l *Logger) extend(setter Setter, apply func(ctx zerolog.Context) zerolog.Context) *Logger {
+	c := l.clone(setter)
+	c.log = apply(c.log.With()).Logger()
+
+	return c
 }
 
-func (l Logger) Debugf(format string, i ...interface{}) {
-	l.log.Debug().Msgf(format, i...)
+// Copy returns a new Logger with its own copy of the setters and of the chain of writers, so mutations of the copy,
+// including SetFormat, Close and ReopenOnSignal, do not affect l.
+// The copy writes to the same output as l, which closing the copy does not close.
+func (l *Logger) Copy() *Logger {
+	c := l.clone()
+	c.setters = append([]Setter(nil), c.setters...)
+
+	if c.o != nil {
+		c.o = c.o.borrow(c.opts.writers, c.format)
+		c.shared = len(c.opts.writers)
+		c.w = c.o
+		c.log = c.log.Output(c.w)
+	}
+
+	return c
 }
 
-func (l Logger) Debugj(j log.JSON) {
-	l.logJSON(l.log.Debug(), j)
+// Tee returns a new Logger writing to both the output of l and w. The receiver is not modified.
+// Like other writer options, it takes effect only when the output is known, i.e. with New or after SetOutput.
+func (l *Logger) Tee(w io.Writer) *Logger {
+	return l.child(WithWriter(w))
 }
 
-func (l Logger) Info(i ...interface{}) {
-	l.log.Info().Msg(fmt.Sprint(i...))
+// WithRequest returns a new Logger with the method, uri and remote_ip fields of the request,
+// named as the middleware does, for logging outside of it.
+func (l *Logger) WithRequest(r *http.Request) *Logger {
+	return l.child(
+		withField("method", r.Method),
+		withField("uri", r.RequestURI),
+		withField("remote_ip", realIP(r)),
+	)
 }
 
-func (l Logger) Infof(format string, i ...interface{}) {
-	l.log.Info().Msgf(format, i...)
+// Named returns a new Logger with the name appended to the dotted logger name.
+func (l *Logger) Named(name string) *Logger {
+	c := l.clone()
+
+	if c.opts.name != "" {
+		name = c.opts.name + "." + name
+	}
+
+	// the name replaces the one of l, so the logger field is not repeated
+	c.setSetter(slotName, withName(name))
+	c.rebuild()
+
+	return c
 }
 
-func (l Logger) Infoj(j log.JSON) {
-	l.logJSON(l.log.Info(), j)
+func (l *Logger) Debug(i ...interface{}) {
+	l.event((*zerolog.Logger).Debug).Msg(fmt.Sprint(i...))
 }
 
-func (l Logger) Warn(i ...interface{}) {
-	l.log.Warn().Msg(fmt.Sprint(i...))
+func (l *Logger) Debugf(format string, i ...interface{}) {
+	l.event((*zerolog.Logger).Debug).Msgf(format, i...)
 }
 
-func (l Logger) Warnf(format string, i ...interface{}) {
-	l.log.Warn().Msgf(format, i...)
+func (l *Logger) Debugj(j log.JSON) {
+	l.logJSON(l.event((*zerolog.Logger).Debug), j)
 }
 
-func (l Logger) Warnj(j log.JSON) {
-	l.logJSON(l.log.Warn(), j)
+// DebugEvery logs a message at debug level only on every nth call from the same call site.
+func (l *Logger) DebugEvery(n int, i ...interface{}) {
+	if n <= 0 {
+		return
+	}
+
+	var pc uintptr
+
+	if pcs := [1]uintptr{}; runtime.Callers(2, pcs[:]) > 0 {
+		pc = pcs[0]
+	}
+
+	counter, ok := callSites.Load(pc)
+
+	if !ok {
+		counter, _ = callSites.LoadOrStore(pc, new(uint64))
+	}
+
+	if (atomic.AddUint64(counter.(*uint64), 1)-1)%uint64(n) != 0 {
+		return
+	}
+
+	l.Debug(i...)
 }
 
-func (l Logger) Error(i ...interface{}) {
-	l.log.Error().Msg(fmt.Sprint(i...))
+// EveryN returns l if at least d has elapsed since the last time EveryN returned l to the same call site,
+// or a logger discarding all records otherwise. It prevents spam from periodic logs, such as heartbeats in a loop.
+// The discarding logger is shared, so it must not be modified.
+func (l *Logger) EveryN(d time.Duration) *Logger {
+	var pc uintptr
+
+	if pcs := [1]uintptr{}; runtime.Callers(2, pcs[:]) > 0 {
+		pc = pcs[0]
+	}
+
+	last, ok := rateSites.Load(pc)
+
+	if !ok {
+		last, _ = rateSites.LoadOrStore(pc, new(int64))
+	}
+
+	now := int64(time.Since(rateEpoch)) + 1
+	prev := atomic.LoadInt64(last.(*int64))
+
+	if (prev != 0 && now-prev < int64(d)) || !atomic.CompareAndSwapInt64(last.(*int64), prev, now) {
+		return nopLogger
+	}
+
+	return l
 }
 
-func (l Logger) Errorf(format string, i ...interface{}) {
-	l.log.Error().Msgf(format, i...)
+func (l *Logger) Info(i ...interface{}) {
+	l.event((*zerolog.Logger).Info).Msg(fmt.Sprint(i...))
 }
 
-func (l Logger) Errorj(j log.JSON) {
-	l.logJSON(l.log.Error(), j)
+func (l *Logger) Infof(format string, i ...interface{}) {
+	l.event((*zerolog.Logger).Info).Msgf(format, i...)
 }
 
-func (l Logger) Fatal(i ...interface{}) {
-	l.log.Fatal().Msg(fmt.Sprint(i...))
+func (l *Logger) Infoj(j log.JSON) {
+	l.logJSON(l.event((*zerolog.Logger).Info), j)
 }
 
-func (l Logger) Fatalf(format string, i ...interface{}) {
-	l.log.Fatal().Msgf(format, i...)
+func (l *Logger) Warn(i ...interface{}) {
+	l.event((*zerolog.Logger).Warn).Msg(fmt.Sprint(i...))
 }
 
-func (l Logger) Fatalj(j log.JSON) {
-	l.logJSON(l.log.Fatal(), j)
+func (l *Logger) Warnf(format string, i ...interface{}) {
+	l.event((*zerolog.Logger).Warn).Msgf(format, i...)
 }
 
-func (l Logger) Panic(i ...interface{}) {
-	l.log.Panic().Msg(fmt.Sprint(i...))
+func (l *Logger) Warnj(j log.JSON) {
+	l.logJSON(l.event((*zerolog.Logger).Warn), j)
 }
 
-func (l Logger) Panicf(format string, i ...interface{}) {
-	l.log.Panic().Msgf(format, i...)
+func (l *Logger) Error(i ...interface{}) {
+	evt := l.event((*zerolog.Logger).Error)
+
+	if opts := l.options(); (opts.errorMarshal != nil || opts.errorField || opts.stack) && len(i) == 1 {
+		if err, ok := i[0].(error); ok {
+			evt = l.withError(evt, err)
+		}
+	}
+
+	evt.Msg(l.errorMessage(fmt.Sprint(i...)))
 }
 
-func (l Logger) Panicj(j log.JSON) {
-	l.logJSON(l.log.Panic(), j)
+func (l *Logger) Errorf(format string, i ...interface{}) {
+	l.event((*zerolog.Logger).Error).Msg(l.errorMessage(fmt.Sprintf(format, i...)))
 }
 
-func (l Logger) Print(i ...interface{}) {
-	l.log.WithLevel(zerolog.NoLevel).Str("level", "-").Msg(fmt.Sprint(i...))
+func (l *Logger) Errorj(j log.JSON) {
+	l.logJSON(l.event((*zerolog.Logger).Error), j)
 }
 
-func (l Logger) Printf(format string, i ...interface{}) {
-	l.log.WithLevel(zerolog.NoLevel).Str("level", "-").Msgf(format, i...)
+func (l *Logger) Fatal(i ...interface{}) {
+	l.event((*zerolog.Logger).Fatal).Msg(fmt.Sprint(i...))
 }
 
-func (l Logger) Printj(j log.JSON) {
-	l.logJSON(l.log.WithLevel(zerolog.NoLevel).Str("level", "-"), j)
+func (l *Logger) Fatalf(format string, i ...interface{}) {
+	l.event((*zerolog.Logger).Fatal).Msgf(format, i...)
 }
 
-func (l Logger) Output() io.Writer {
-	return l.log
+func (l *Logger) Fatalj(j log.JSON) {
+	l.logJSON(l.event((*zerolog.Logger).Fatal), j)
+}
+
+func (l *Logger) Panic(i ...interface{}) {
+	l.event((*zerolog.Logger).Panic).Msg(fmt.Sprint(i...))
+}
+
+func (l *Logger) Panicf(format string, i ...interface{}) {
+	l.event((*zerolog.Logger).Panic).Msgf(format, i...)
+}
+
+func (l *Logger) Panicj(j log.JSON) {
+	l.logJSON(l.event((*zerolog.Logger).Panic), j)
+}
+
+// PanicErr logs the error with its type at panic level and then panics with the original error.
+func (l *Logger) PanicErr(err error) {
+	l.withError(l.withLevel(zerolog.PanicLevel), err).
+		Str("error_type", fmt.Sprintf("%T", err)).
+		Msg("")
+
+	panic(err)
+}
+
+// InfoArray logs a message with the items as an array at info level, without reflection.
+func (l *Logger) InfoArray(key string, items []string, msg string) {
+	l.event((*zerolog.Logger).Info).Strs(key, items).Msg(msg)
+}
+
+// InfoInts logs a message with the items as an array at info level, without reflection.
+// The module supports Go versions without generics, hence a method per element type.
+func (l *Logger) InfoInts(key string, items []int, msg string) {
+	l.event((*zerolog.Logger).Info).Ints(key, items).Msg(msg)
+}
+
+// InfoKV logs a message with fields from alternating keys and values at info level, e.g. InfoKV("saved", "id", 1, "name", "foo").
+// Keys that are not strings are formatted with fmt.Sprint. A key without a value is logged with a null value and an error field.
+func (l *Logger) InfoKV(msg string, kv ...interface{}) {
+	evt := l.event((*zerolog.Logger).Info)
+
+	if evt.Enabled() {
+		evt = kvFields(evt, kv)
+	}
+
+	evt.Msg(msg)
+}
+
+// LogHTTPStatus logs a message with the status at a level derived from it: error for 5xx, warn for 4xx and info otherwise,
+// e.g. in a custom echo.HTTPErrorHandler.
+func (l *Logger) LogHTTPStatus(status int, msg string) {
+	l.withLevel(statusLevel(status)).Int("status", status).Msg(msg)
+}
+
+// LogAt logs a message at the given level with t as its timestamp instead of the current time, e.g. when replaying events.
+// Timestamps added by WithTimestamp and WithTimeFunc are skipped, but not the ones of the wrapped zerolog logger.
+// The record is written through a logger built once from the setters without them.
+func (l *Logger) LogAt(t time.Time, level log.Lvl, msg string) {
+	zlvl, _ := MatchEchoLevel(level)
+
+	if zlvl < l.logger().GetLevel() || zlvl < zerolog.GlobalLevel() {
+		return
+	}
+
+	zl := l.untimed()
+	zl.WithLevel(zlvl).Time(zerolog.TimestampFieldName, t).Msg(msg)
+}
+
+// untimed returns the zerolog logger of l rebuilt without the timestamps of WithTimestamp and WithTimeFunc.
+// It is built on first use and cached until the setters or the output change.
+func (l *Logger) untimed() zerolog.Logger {
+	l.mu.RLock()
+	zl, level := l.untimedLog, l.log.GetLevel()
+	l.mu.RUnlock()
+
+	if zl == nil {
+		l.mu.Lock()
+
+		if l.untimedLog == nil {
+			setters := make([]Setter, 0, len(l.setters)+1)
+			setters = append(setters, func(opts *Options) {
+				opts.untimed = true
+			})
+			setters = append(setters, l.setters...)
+
+			built := newOptions(l.opts.base, setters).context.Logger()
+
+			if l.w != nil {
+				built = built.Output(l.w)
+			}
+
+			l.untimedLog = &built
+		}
+
+		zl, level = l.untimedLog, l.log.GetLevel()
+		l.mu.Unlock()
+	}
+
+	return zl.Level(level)
+}
+
+// Emit logs an event with the given name as the event field and the given fields at info level.
+// A field named event does not override the name.
+func (l *Logger) Emit(name string, fields map[string]interface{}) {
+	if _, found := fields["event"]; found {
+		fields = mergeFields(fields, nil)
+		delete(fields, "event")
+	}
+
+	l.event((*zerolog.Logger).Info).Str("event", name).Fields(fields).Send()
+}
+
+// Timed returns a function logging the time elapsed since Timed was called as duration, along with op, at the given level.
+// For example:
+//
+//	defer l.Timed(log.INFO, "db.query")()
+func (l *Logger) Timed(level log.Lvl, op string) func() {
+	start := time.Now()
+
+	return func() {
+		zlvl, _ := MatchEchoLevel(level)
+
+		l.withLevel(zlvl).Str("op", op).Dur("duration", time.Since(start)).Send()
+	}
+}
+
+// Stack logs a message with the current stack at the given level.
+func (l *Logger) Stack(level log.Lvl, msg string) {
+	zlvl, _ := MatchEchoLevel(level)
+	evt := l.withLevel(zlvl)
+
+	if evt.Enabled() {
+		evt = evt.Array(zerolog.ErrorStackFieldName, callers(l.options().stackSkip))
+	}
+
+	evt.Msg(msg)
+}
+
+// DebugIf returns a message logged at debug level only if cond is true.
+func (l *Logger) DebugIf(cond bool) *ConditionalLogger {
+	return l.conditional(cond, (*zerolog.Logger).Debug)
+}
+
+// InfoIf returns a message logged at info level only if cond is true.
+func (l *Logger) InfoIf(cond bool) *ConditionalLogger {
+	return l.conditional(cond, (*zerolog.Logger).Info)
+}
+
+// WarnIf returns a message logged at warn level only if cond is true.
+func (l *Logger) WarnIf(cond bool) *ConditionalLogger {
+	return l.conditional(cond, (*zerolog.Logger).Warn)
+}
+
+// ErrorIf returns a message logged at error level only if cond is true.
+func (l *Logger) ErrorIf(cond bool) *ConditionalLogger {
+	return l.conditional(cond, (*zerolog.Logger).Error)
+}
+
+func (l *Logger) conditional(cond bool, start func(zl *zerolog.Logger) *zerolog.Event) *ConditionalLogger {
+	if !cond {
+		return nil
+	}
+
+	return (*ConditionalLogger)(l.event(start))
+}
+
+func (l *Logger) Print(i ...interface{}) {
+	l.withLevel(zerolog.NoLevel).Str("level", "-").Msg(fmt.Sprint(i...))
+}
+
+func (l *Logger) Printf(format string, i ...interface{}) {
+	if l.options().startupParsing && l.logStartup(fmt.Sprintf(format, i...)) {
+		return
+	}
+
+	l.withLevel(zerolog.NoLevel).Str("level", "-").Msgf(format, i...)
+}
+
+func (l *Logger) Printj(j log.JSON) {
+	l.logJSON(l.withLevel(zerolog.NoLevel).Str("level", "-"), j)
+}
+
+func (l *Logger) Output() io.Writer {
+	if l.options().startupParsing {
+		return startupWriter{logger: l, out: l.logger()}
+	}
+
+	return l.logger()
 }
 
 func (l *Logger) SetOutput(newOut io.Writer) {
-	l.out = newOut
-	l.log = l.log.Output(newOut)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.setOutput(newOut)
 }
 
-func (l Logger) Level() log.Lvl {
+func (l *Logger) Level() log.Lvl {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	return l.level
 }
 
 func (l *Logger) SetLevel(level log.Lvl) {
-	zlvl, elvl := MatchEchoLevel(level)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.setLevel(level)
+}
+
+// SetLevelGlobal sets the level of the logger and the global zerolog level.
+// Note that the global level affects every zerolog logger in the process.
+func (l *Logger) SetLevelGlobal(level log.Lvl) {
+	zlvl, _ := MatchEchoLevel(level)
+
+	l.SetLevel(level)
+	zerolog.SetGlobalLevel(zlvl)
+}
+
+// Reconfigure sets the output and the level at once,
+// so that no record is written to the new output with the old level or vice versa.
+func (l *Logger) Reconfigure(out io.Writer, level log.Lvl) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.setOutput(out)
+	l.setLevel(level)
+}
+
+func (l *Logger) setOutput(newOut io.Writer) {
+	l.o = newOutput(newOut, l.opts.writers, l.format)
+	l.shared = len(l.opts.writers)
+	l.w = l.o
+	l.log = l.log.Output(l.w)
+	l.untimedLog = nil
+}
+
+// WriteErrors returns the number of records that failed to be written to the primary output when using WithFallback.
+func (l *Logger) WriteErrors() uint64 {
+	fallback := l.options().fallback
+
+	if fallback == nil {
+		return 0
+	}
+
+	return fallback.Errors()
+}
+
+// Flush writes any buffered records to the underlying output.
+func (l *Logger) Flush() error {
+	l.mu.RLock()
+	w := l.w
+	l.mu.RUnlock()
+
+	return flushWriter(w)
+}
+
+// Close flushes any buffered records and closes the output if it implements io.Closer.
+// Further records are discarded, unless a new output is set with SetOutput.
+// Loggers derived from l share its output, so their records are discarded too, e.g. those of in-flight requests.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+
+	if l.o != nil {
+		// the writers wrapping the output are flushed first, so their records reach it before it is closed
+		err = flushWriter(l.w)
 
-	l.setters = append(l.setters, WithLevel(elvl))
+		if cerr := l.o.close(); err == nil {
+			err = cerr
+		}
+	}
+
+	// the options are shared, so they are copied to discard the records of the loggers rebuilt from l
+	opts := *l.opts
+	opts.base = opts.base.Output(io.Discard)
+	l.opts = &opts
+	l.w = io.Discard
+	l.log = l.log.Output(io.Discard)
+	l.untimedLog = nil
+
+	return err
+}
+
+func (l *Logger) setLevel(level log.Lvl) {
+	zlvl, _ := MatchEchoLevel(level)
+
+	l.setZeroLevel(zlvl)
+}
+
+// setZeroLevel sets the zerolog level, which has no echo equivalent for trace.
+func (l *Logger) setZeroLevel(level zerolog.Level) {
+	elvl, zlvl := MatchZeroLevel(level)
+
+	l.setSetter(slotLevel, withZeroLevel(zlvl))
 	l.level = elvl
 	l.log = l.log.Level(zlvl)
 }
 
-func (l Logger) Prefix() string {
-	return l.prefix
+func (l *Logger) Prefix() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.opts.prefix
 }
 
-func (l Logger) SetHeader(h string) {
+func (l *Logger) SetHeader(h string) {
 	// not implemented
 }
 
+// SetPrefix sets the prefix of the logger.
+// An empty prefix removes the prefix field.
 func (l *Logger) SetPrefix(newPrefix string) {
-	l.setters = append(l.setters, WithPrefix(newPrefix))
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-	opts := newOptions(l.log, l.setters)
+	l.setSetter(slotPrefix, WithPrefix(newPrefix))
 
-	l.prefix = newPrefix
-	l.log = opts.context.Logger()
+	l.rebuild()
+}
+
+// SetFormat switches the output between FormatJSON and FormatConsole, keeping the fields and the level of the logger.
+// It applies to the loggers derived from l too, such as the request loggers of the middleware.
+// Like other writer options, it takes effect only when the output is known, i.e. with New or after SetOutput.
+// It does not affect the output of WithLevelColors, which is always written in the console format.
+func (l *Logger) SetFormat(format string) error {
+	if format != FormatJSON && format != FormatConsole {
+		return fmt.Errorf("unknown format: %q", format)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.format = format
+
+	if l.o != nil {
+		l.o.reset(l.o.out, l.opts.writers[:l.shared], format)
+	}
+
+	return nil
+}
+
+// SetCallerSkip sets the number of stack frames to skip when reporting the caller.
+func (l *Logger) SetCallerSkip(skipFrameCount int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.setSetter(slotCaller, WithCallerWithSkipFrameCount(skipFrameCount))
+
+	l.rebuild()
+}
+
+// AddFields extends the logger's context with the provided fields.
+// A field already added by AddFields is replaced.
+func (l *Logger) AddFields(fields map[string]interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// a single setter holds all the added fields, so repeated calls do not grow the setters
+	l.added = mergeFields(l.added, fields)
+	l.setSetter(slotFields, WithFields(l.added))
+
+	l.rebuild()
+}
+
+// Fields returns a copy of the fields added by WithField, WithFields and AddFields.
+func (l *Logger) Fields() map[string]interface{} {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// the fields are collected from the setters, so that loggers derived for each request do not have to merge them
+	return mergeFields(newOptions(l.opts.base, l.setters).fields, nil)
 }
 
 func (l *Logger) Unwrap() zerolog.Logger {
+	return l.logger()
+}
+
+// options returns the options of the last rebuild.
+func (l *Logger) options() *Options {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.opts
+}
+
+// logger returns a snapshot of the current zerolog log.
+func (l *Logger) logger() zerolog.Logger {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	return l.log
 }
 
+// event starts a new message using the given zerolog method, e.g. (*zerolog.Logger).Info.
+func (l *Logger) event(start func(zl *zerolog.Logger) *zerolog.Event) *zerolog.Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return start(&l.log)
+}
+
+// withLevel starts a new message with the given level.
+func (l *Logger) withLevel(level zerolog.Level) *zerolog.Event {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.log.WithLevel(level)
+}
+
+// setSetter replaces the setter in the slot, or appends it if the slot is empty.
+// The setters may be shared with other loggers, see clone, so they are copied first.
+// The caller must hold the write lock or own l exclusively.
+func (l *Logger) setSetter(slot int, setter Setter) {
+	setters := make([]Setter, len(l.setters), len(l.setters)+1)
+	copy(setters, l.setters)
+
+	if i := l.slots[slot]; i > 0 {
+		setters[i-1] = setter
+	} else {
+		setters = append(setters, setter)
+		l.slots[slot] = len(setters)
+	}
+
+	l.setters = setters
+	l.untimedLog = nil
+}
+
+// rebuild re-applies the setters on top of the base logger.
+// The caller must hold the write lock or own l exclusively.
+func (l *Logger) rebuild() {
+	opts := newOptions(l.opts.base, l.setters)
+
+	l.opts = opts
+	l.level = opts.level
+	l.log = opts.context.Logger()
+	l.untimedLog = nil
+
+	for slot, i := range opts.slots {
+		if i > 0 {
+			l.slots[slot] = i
+		}
+	}
+
+	// the writers of the shared output are kept, so their state, e.g. buffered records, is not lost
+	if l.o != nil {
+		shared := l.shared
+
+		if shared > len(opts.writers) {
+			shared = len(opts.writers)
+		}
+
+		l.w = wrapWriter(l.o, opts.writers[shared:])
+		l.log = l.log.Output(l.w)
+	}
+}
+
+// errEvent starts a new message with error level and the given error attached.
+func (l *Logger) errEvent(err error) *zerolog.Event {
+	return l.withError(l.event((*zerolog.Logger).Error), err)
+}
+
+// withError attaches the error to the event honoring the error options.
+func (l *Logger) withError(evt *zerolog.Event, err error) *zerolog.Event {
+	opts := l.options()
+
+	if opts.stack && evt.Enabled() {
+		evt = errorStack(evt, err, opts.stackSkip)
+	}
+
+	if opts.errorMarshal != nil {
+		return evt.Interface(zerolog.ErrorFieldName, opts.errorMarshal(err))
+	}
+
+	if opts.compactErrors {
+		return evt.Str(zerolog.ErrorFieldName, compactError(err.Error()))
+	}
+
+	return evt.Err(err)
+}
+
+func (l *Logger) errorMessage(msg string) string {
+	if !l.options().compactErrors {
+		return msg
+	}
+
+	return compactError(msg)
+}
+
 func (l *Logger) logJSON(event *zerolog.Event, j log.JSON) {
 	for k, v := range j {
-		event = event.Interface(k, v)
+		if raw, ok := l.rawJSON(k, v); ok {
+			event = event.RawJSON(k, raw)
+		} else {
+			event = event.Interface(k, v)
+		}
 	}
 
 	event.Msg("")
 }
+
+// kvFields adds the alternating keys and values to the event, using typed fields for common types.
+func kvFields(evt *zerolog.Event, kv []interface{}) *zerolog.Event {
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+
+		if i+1 == len(kv) {
+			return evt.Interface(key, nil).
+				Str(zerolog.ErrorFieldName, fmt.Sprintf("missing value for key %q", key))
+		}
+
+		switch v := kv[i+1].(type) {
+		case string:
+			evt = evt.Str(key, v)
+		case int:
+			evt = evt.Int(key, v)
+		case int64:
+			evt = evt.Int64(key, v)
+		case uint64:
+			evt = evt.Uint64(key, v)
+		case float64:
+			evt = evt.Float64(key, v)
+		case bool:
+			evt = evt.Bool(key, v)
+		case time.Duration:
+			evt = evt.Dur(key, v)
+		case time.Time:
+			evt = evt.Time(key, v)
+		case error:
+			evt = evt.AnErr(key, v)
+		default:
+			evt = evt.Interface(key, v)
+		}
+	}
+
+	return evt
+}
+
+// realIP returns the client IP the same way as echo.Context.RealIP does without a custom IP extractor.
+func realIP(r *http.Request) string {
+	if ip := r.Header.Get(echo.HeaderXForwardedFor); ip != "" {
+		if i := strings.IndexByte(ip, ','); i > 0 {
+			ip = strings.TrimSpace(ip[:i])
+		}
+
+		return strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+	}
+
+	if ip := r.Header.Get(echo.HeaderXRealIP); ip != "" {
+		return strings.TrimSuffix(strings.TrimPrefix(ip, "["), "]")
+	}
+
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+
+	return ip
+}
+
+// rawJSON returns the value of the field as JSON to embed as is, if the field is listed by WithRawJSONFields.
+func (l *Logger) rawJSON(key string, value interface{}) ([]byte, bool) {
+	if _, found := l.options().rawJSONFields[key]; !found {
+		return nil, false
+	}
+
+	var raw []byte
+
+	switch v := value.(type) {
+	case json.RawMessage:
+		raw = v
+	case []byte:
+		raw = v
+	case string:
+		raw = []byte(v)
+	default:
+		return nil, false
+	}
+
+	return raw, json.Valid(raw)
+}
+
+var errorReplacer = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+func compactError(msg string) string {
+	return errorReplacer.Replace(msg)
+}
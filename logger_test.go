@@ -2,9 +2,19 @@ package lecho_test
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -59,43 +69,337 @@ func TestFrom(t *testing.T) {
 	)
 }
 
+func TestBuildZerolog(t *testing.T) {
+	b := &bytes.Buffer{}
+
+	zl := lecho.BuildZerolog(b, lecho.WithLevel(log.WARN), lecho.WithField("key", "test"), lecho.WithPrefix("foo"))
+
+	zl.Info().Msg("bar")
+
+	assert.Empty(t, b.String())
+
+	zl.Warn().Msg("baz")
+
+	assert.Equal(
+		t,
+		`{"level":"warn","key":"test","prefix":"foo","message":"baz"}
+`,
+		b.String(),
+	)
+}
+
 func TestLogger_SetPrefix(t *testing.T) {
-	//	b := &bytes.Buffer{}
-	//
-	//	l := lecho.New(b)
-	//
-	//	l.Print("t-e-s-t")
-	//
-	//	assert.Equal(
-	//		t,
-	//		`{"level":"-","message":"t-e-s-t"}
-	//`,
-	//		b.String(),
-	//	)
-	//
-	//	b.Reset()
-	//
-	//	l.SetPrefix("foo")
-	//	l.Print("test")
-	//
-	//	assert.Equal(
-	//		t,
-	//		`{"prefix":"foo","level":"-","message":"test"}
-	//`,
-	//		b.String(),
-	//	)
-	//
-	//	b.Reset()
-	//
-	//	l.SetPrefix("bar")
-	//	l.Print("test-test")
-	//
-	//	assert.Equal(
-	//		t,
-	//		`{"prefix":"bar","level":"-","message":"test-test"}
-	//`,
-	//		b.String(),
-	//	)
+	b := &bytes.Buffer{}
+
+	l := lecho.New(b)
+
+	l.Print("t-e-s-t")
+
+	assert.Equal(
+		t,
+		`{"level":"-","message":"t-e-s-t"}
+`,
+		b.String(),
+	)
+
+	b.Reset()
+
+	l.SetPrefix("foo")
+	l.Print("test")
+
+	assert.Equal(
+		t,
+		`{"prefix":"foo","level":"-","message":"test"}
+`,
+		b.String(),
+	)
+	assert.Equal(t, "foo", l.Prefix())
+
+	b.Reset()
+
+	l.SetPrefix("bar")
+	l.Print("test-test")
+
+	assert.Equal(
+		t,
+		`{"prefix":"bar","level":"-","message":"test-test"}
+`,
+		b.String(),
+	)
+	assert.Equal(t, "bar", l.Prefix())
+
+	b.Reset()
+
+	l.SetPrefix("")
+	l.Print("test-test-test")
+
+	assert.Equal(
+		t,
+		`{"level":"-","message":"test-test-test"}
+`,
+		b.String(),
+	)
+	assert.Empty(t, l.Prefix())
+
+	b.Reset()
+
+	l = lecho.New(b, lecho.WithPrefix("foo"), lecho.WithField("key", "test"))
+	l.Named("child").Print("ordered")
+	l.SetPrefix("bar")
+	l.Print("ordered")
+	l.SetPrefix("")
+	l.Print("ordered")
+
+	assert.Equal(
+		t,
+		`{"prefix":"foo","key":"test","logger":"child","level":"-","message":"ordered"}
+{"prefix":"bar","key":"test","level":"-","message":"ordered"}
+{"key":"test","level":"-","message":"ordered"}
+`,
+		b.String(),
+		"should keep the position of the prefix field",
+	)
+}
+
+func TestLogger_SetCallerSkip(t *testing.T) {
+	b := &bytes.Buffer{}
+
+	l := lecho.New(b, lecho.WithCaller())
+
+	caller := func() string {
+		entry := struct {
+			Caller string `json:"caller"`
+		}{}
+
+		assert.NoError(t, json.Unmarshal(b.Bytes(), &entry))
+		assert.Equal(t, 1, strings.Count(b.String(), `"caller"`))
+
+		b.Reset()
+
+		return filepath.Base(strings.Split(entry.Caller, ":")[0])
+	}
+
+	l.Print("foo")
+
+	assert.Equal(t, "logger.go", caller())
+
+	l.SetCallerSkip(3)
+	l.Print("bar")
+
+	assert.Equal(t, "logger_test.go", caller())
+}
+
+func TestLogger_Named(t *testing.T) {
+	b := &bytes.Buffer{}
+
+	l := lecho.New(b)
+	a := l.Named("a")
+	ab := a.Named("b")
+
+	ab.Print("foo")
+
+	assert.Equal(
+		t,
+		`{"logger":"a.b","level":"-","message":"foo"}
+`,
+		b.String(),
+	)
+
+	b.Reset()
+
+	a.Print("bar")
+
+	assert.Equal(
+		t,
+		`{"logger":"a","level":"-","message":"bar"}
+`,
+		b.String(),
+	)
+
+	b.Reset()
+
+	l.Print("baz")
+
+	assert.Equal(
+		t,
+		`{"level":"-","message":"baz"}
+`,
+		b.String(),
+	)
+
+	b.Reset()
+
+	a.SetPrefix("p")
+	a.Print("qux")
+
+	assert.Equal(
+		t,
+		`{"logger":"a","prefix":"p","level":"-","message":"qux"}
+`,
+		b.String(),
+		"should not share the replaced setters with the derived loggers",
+	)
+}
+
+func TestLogger_Copy(t *testing.T) {
+	b := &bytes.Buffer{}
+
+	l := lecho.New(b, lecho.WithField("key", "test"), lecho.WithPrefix("foo"))
+	c := l.Copy()
+
+	c.SetLevel(log.WARN)
+	c.SetPrefix("bar")
+	c.AddFields(map[string]interface{}{"copy": true})
+
+	l.Info("test")
+
+	assert.Equal(
+		t,
+		`{"level":"info","key":"test","prefix":"foo","message":"test"}
+`,
+		b.String(),
+	)
+	assert.Equal(t, "foo", l.Prefix())
+	assert.Equal(t, log.DEBUG, l.Level())
+
+	b.Reset()
+
+	c.Info("test")
+
+	assert.Empty(t, b.String())
+
+	c.Warn("test")
+
+	assert.Equal(
+		t,
+		`{"level":"warn","key":"test","prefix":"bar","copy":true,"message":"test"}
+`,
+		b.String(),
+	)
+
+	cb := &closingBuffer{}
+	l = lecho.New(cb)
+	c = l.Copy()
+
+	assert.NoError(t, c.SetFormat(lecho.FormatConsole))
+	assert.NoError(t, c.Close())
+
+	c.Info("copy")
+	l.Info("original")
+
+	assert.False(t, cb.isClosed(), "should not close the output of the original")
+	assert.Equal(t, `{"level":"info","message":"original"}
+`, cb.String(), "should keep the format of the original")
+}
+
+func TestLogger_Tee(t *testing.T) {
+	b := &bytes.Buffer{}
+	tb := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithField("foo", "bar"))
+	tee := l.Tee(tb)
+
+	tee.Info("both")
+	l.Info("original")
+
+	assert.Equal(t, `{"level":"info","foo":"bar","message":"both"}
+{"level":"info","foo":"bar","message":"original"}
+`, b.String())
+	assert.Equal(t, `{"level":"info","foo":"bar","message":"both"}
+`, tb.String())
+}
+
+func TestLogger_WithRequest(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	req := httptest.NewRequest(http.MethodPost, "/foo?bar=baz", nil)
+	req.Header.Set(echo.HeaderXForwardedFor, "1.2.3.4, 10.0.0.1")
+	rl := l.WithRequest(req)
+
+	rl.Info("first")
+	rl.Warn("second")
+	l.Info("third")
+
+	assert.Equal(t, `{"level":"info","method":"POST","uri":"/foo?bar=baz","remote_ip":"1.2.3.4","message":"first"}
+{"level":"warn","method":"POST","uri":"/foo?bar=baz","remote_ip":"1.2.3.4","message":"second"}
+{"level":"info","message":"third"}
+`, b.String())
+
+	b.Reset()
+	l.WithRequest(httptest.NewRequest(http.MethodGet, "/", nil)).Info("foo")
+
+	assert.Contains(t, b.String(), `"remote_ip":"192.0.2.1"`)
+}
+
+type closingBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+	closed   bool
+	rejected int
+}
+
+func (b *closingBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		b.rejected++
+
+		return 0, errors.New("write to closed buffer")
+	}
+
+	return b.Buffer.Write(p)
+}
+
+func (b *closingBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	return nil
+}
+
+func (b *closingBuffer) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.closed
+}
+
+func (b *closingBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.Buffer.String()
+}
+
+func TestLogger_Close(t *testing.T) {
+	b := &closingBuffer{}
+	l := lecho.New(b, lecho.WithBufferedWriter(1024))
+
+	l.Info("foo")
+
+	assert.NoError(t, l.Close())
+	assert.True(t, b.closed)
+	assert.Equal(t, `{"level":"info","message":"foo"}
+`, b.String(), "should flush before closing")
+
+	assert.NotPanics(t, func() {
+		l.Info("bar")
+		l.SetPrefix("baz")
+		l.Named("child").Info("qux")
+	})
+	assert.NoError(t, l.Flush())
+	assert.Equal(t, `{"level":"info","message":"foo"}
+`, b.String(), "should discard records after closing")
+
+	nb := &bytes.Buffer{}
+	l.SetOutput(nb)
+	l.Info("bar")
+	assert.NoError(t, l.Flush())
+
+	assert.Contains(t, nb.String(), `"message":"bar"`)
 }
 
 func TestLogger_Output(t *testing.T) {
@@ -150,6 +454,567 @@ func TestLogger_SetLevel(t *testing.T) {
 	assert.Equal(t, "", b.String())
 }
 
+func TestLogger_AddFields(t *testing.T) {
+	b := &bytes.Buffer{}
+
+	l := lecho.New(b, lecho.WithField("service", "logging"))
+
+	l.Print("foo")
+
+	assert.Equal(
+		t,
+		`{"service":"logging","level":"-","message":"foo"}
+`,
+		b.String(),
+	)
+
+	b.Reset()
+
+	l.AddFields(map[string]interface{}{
+		"host": "localhost",
+	})
+	l.Print("bar")
+
+	assert.Equal(
+		t,
+		`{"service":"logging","host":"localhost","level":"-","message":"bar"}
+`,
+		b.String(),
+	)
+
+	b.Reset()
+
+	l.AddFields(map[string]interface{}{
+		"host": "example.com",
+	})
+	l.SetPrefix("api")
+	l.SetPrefix("web")
+	l.Print("baz")
+
+	assert.Equal(
+		t,
+		`{"service":"logging","host":"example.com","prefix":"web","level":"-","message":"baz"}
+`,
+		b.String(),
+		"should replace the added fields and the prefix when rebuilt",
+	)
+
+	b.Reset()
+
+	l.AddFields(map[string]interface{}{"a": 1})
+	l.AddFields(map[string]interface{}{"a": 2})
+	l.Print("qux")
+
+	assert.Equal(
+		t,
+		`{"service":"logging","a":2,"host":"example.com","prefix":"web","level":"-","message":"qux"}
+`,
+		b.String(),
+		"should override an added field instead of repeating it",
+	)
+}
+
+type mockLogger struct {
+	lecho.LoggerIface
+	infos []string
+}
+
+func (m *mockLogger) Info(i ...interface{}) {
+	m.infos = append(m.infos, fmt.Sprint(i...))
+}
+
+func TestLogger_Fields(t *testing.T) {
+	l := lecho.New(
+		&bytes.Buffer{},
+		lecho.WithField("foo", "bar"),
+		lecho.WithFields(map[string]interface{}{"baz": 1, "foo": "qux"}),
+	)
+
+	assert.Equal(t, map[string]interface{}{"foo": "qux", "baz": 1}, l.Fields())
+
+	c := l.Named("child")
+	c.AddFields(map[string]interface{}{"quux": true})
+
+	assert.Equal(t, map[string]interface{}{"foo": "qux", "baz": 1, "quux": true}, c.Fields())
+	assert.Equal(t, map[string]interface{}{"foo": "qux", "baz": 1}, l.Fields(), "should not change the parent")
+
+	fields := l.Fields()
+	fields["foo"] = "changed"
+
+	assert.Equal(t, "qux", l.Fields()["foo"], "should return a copy")
+	assert.Empty(t, lecho.New(&bytes.Buffer{}).Fields())
+}
+
+func TestLoggerIface(t *testing.T) {
+	greet := func(l lecho.LoggerIface, name string) {
+		l.Info("hello ", name)
+	}
+
+	m := &mockLogger{}
+	greet(m, "foo")
+
+	assert.Equal(t, []string{"hello foo"}, m.infos)
+
+	b := &bytes.Buffer{}
+	greet(lecho.New(b), "bar")
+
+	assert.Equal(
+		t,
+		`{"level":"info","message":"hello bar"}
+`,
+		b.String(),
+	)
+}
+
+type panicError struct {
+	code int
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("code %d", e.code)
+}
+
+func TestLogger_PanicErr(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+	err := &panicError{code: 42}
+
+	assert.PanicsWithValue(t, err, func() {
+		l.PanicErr(err)
+	})
+
+	assert.Equal(
+		t,
+		`{"level":"panic","error":"code 42","error_type":"*lecho_test.panicError"}
+`,
+		b.String(),
+	)
+}
+
+func TestLogger_SetLevelGlobal(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	l.SetLevelGlobal(log.WARN)
+
+	assert.Equal(t, log.WARN, l.Level())
+	assert.Equal(t, zerolog.WarnLevel, zerolog.GlobalLevel())
+
+	l.Info("foo")
+
+	assert.Empty(t, b.String())
+}
+
+func TestLogger_SetFormat(t *testing.T) {
+	b := &bytes.Buffer{}
+	tee := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithField("app", "foo"), lecho.WithWriter(tee))
+	l.SetLevel(log.WARN)
+
+	assert.NoError(t, l.SetFormat(lecho.FormatConsole))
+
+	l.Info("skipped")
+	l.Warn("bar")
+
+	assert.NotContains(t, b.String(), "skipped", "should keep the level")
+	assert.False(t, strings.HasPrefix(b.String(), "{"), "should write in the console format")
+	assert.Contains(t, b.String(), "WRN")
+	assert.Contains(t, b.String(), "bar")
+	assert.Contains(t, b.String(), "app=\x1b[0mfoo", "should keep the fields")
+	assert.Equal(t, `{"level":"warn","app":"foo","message":"bar"}
+`, tee.String(), "should write JSON to other writers")
+
+	b.Reset()
+	assert.NoError(t, l.SetFormat(lecho.FormatJSON))
+
+	l.Warn("baz")
+
+	assert.Equal(t, `{"level":"warn","app":"foo","message":"baz"}
+`, b.String())
+
+	assert.EqualError(t, l.SetFormat("xml"), `unknown format: "xml"`)
+}
+
+func TestLogger_Reconfigure(t *testing.T) {
+	out1 := &bytes.Buffer{}
+	out2 := &bytes.Buffer{}
+	w1 := zerolog.SyncWriter(out1)
+	w2 := zerolog.SyncWriter(out2)
+
+	l := lecho.New(w1)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					l.Debug("foo")
+					l.Warn("bar")
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			l.Reconfigure(w2, log.WARN)
+		} else {
+			l.Reconfigure(w1, log.DEBUG)
+		}
+	}
+
+	l.Reconfigure(w2, log.WARN)
+
+	close(done)
+	wg.Wait()
+
+	assert.Equal(t, log.WARN, l.Level())
+
+	out2.Reset()
+
+	l.Debug("foo")
+	l.Warn("bar")
+
+	assert.Equal(
+		t,
+		`{"level":"warn","message":"bar"}
+`,
+		out2.String(),
+	)
+}
+
+func TestLogger_InfoArray(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	l.InfoArray("ids", []string{"a", "b"}, "foo")
+	l.InfoInts("ids", []int{1, 2}, "bar")
+	l.InfoArray("ids", nil, "baz")
+
+	assert.Equal(t, `{"level":"info","ids":["a","b"],"message":"foo"}
+{"level":"info","ids":[1,2],"message":"bar"}
+{"level":"info","ids":[],"message":"baz"}
+`, b.String())
+}
+
+func TestLogger_InfoKV(t *testing.T) {
+	t.Run("should log the pairs as fields", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(b)
+
+		l.InfoKV("foo",
+			"name", "john",
+			"count", 2,
+			"ratio", 0.5,
+			"ok", true,
+			"took", 1500*time.Millisecond,
+			"at", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			"err", errors.New("boom"),
+			"tags", []string{"a"},
+			1, "one",
+		)
+		l.InfoKV("bar")
+
+		assert.Equal(t, `{"level":"info","name":"john","count":2,"ratio":0.5,"ok":true,"took":1500,"at":"2020-01-02T03:04:05Z","err":"boom","tags":["a"],"1":"one","message":"foo"}
+{"level":"info","message":"bar"}
+`, b.String())
+	})
+
+	t.Run("should log an error for a key without a value", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(b)
+
+		l.InfoKV("foo", "name", "john", "count")
+
+		assert.Equal(t, `{"level":"info","name":"john","count":null,"error":"missing value for key \"count\"","message":"foo"}
+`, b.String())
+	})
+}
+
+func BenchmarkLogger_InfoArray(b *testing.B) {
+	l := lecho.New(io.Discard)
+	ids := []string{"4bf92f35", "77b34da6", "a3ce929d", "0e0e4736"}
+
+	b.Run("InfoArray", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			l.InfoArray("ids", ids, "foo")
+		}
+	})
+
+	b.Run("Infoj", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			l.Infoj(log.JSON{"ids": ids})
+		}
+	})
+}
+
+func TestLogger_LogHTTPStatus(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	l.LogHTTPStatus(http.StatusOK, "ok")
+	l.LogHTTPStatus(http.StatusFound, "found")
+	l.LogHTTPStatus(http.StatusNotFound, "not found")
+	l.LogHTTPStatus(http.StatusServiceUnavailable, "unavailable")
+
+	assert.Equal(t, `{"level":"info","status":200,"message":"ok"}
+{"level":"info","status":302,"message":"found"}
+{"level":"warn","status":404,"message":"not found"}
+{"level":"error","status":503,"message":"unavailable"}
+`, b.String())
+}
+
+func TestLogger_LogAt(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, setter := range []lecho.Setter{
+		lecho.WithTimestamp(),
+		lecho.WithTimeFunc(time.Now),
+	} {
+		b := &bytes.Buffer{}
+		l := lecho.New(b, setter)
+
+		l.LogAt(at, log.WARN, "foo")
+		l.LogAt(at, log.DEBUG, "bar")
+
+		assert.Equal(t, `{"level":"warn","time":"2020-01-02T03:04:05Z","message":"foo"}
+{"level":"debug","time":"2020-01-02T03:04:05Z","message":"bar"}
+`, b.String())
+
+		b.Reset()
+		l.Info("baz")
+
+		assert.NotContains(t, b.String(), "2020-01-02", "should use the current time for other records")
+		assert.Contains(t, b.String(), `"time":`)
+	}
+
+	t.Run("should follow the changes of the logger", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithTimestamp())
+
+		l.LogAt(at, log.INFO, "foo")
+		l.SetPrefix("p")
+		l.AddFields(map[string]interface{}{"a": 1})
+		l.LogAt(at, log.INFO, "bar")
+		l.SetLevel(log.WARN)
+		l.LogAt(at, log.INFO, "baz")
+
+		assert.Equal(t, `{"level":"info","time":"2020-01-02T03:04:05Z","message":"foo"}
+{"level":"info","prefix":"p","a":1,"time":"2020-01-02T03:04:05Z","message":"bar"}
+`, b.String())
+	})
+
+	t.Run("should keep the timestamps of concurrent records", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(zerolog.SyncWriter(b), lecho.WithTimestamp())
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 20000; j++ {
+					l.LogAt(at, log.INFO, "replayed")
+					l.Info("live")
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+
+		assert.Len(t, lines, 320000)
+
+		for _, line := range lines {
+			if strings.Contains(line, "replayed") {
+				assert.Equal(t, `{"level":"info","time":"2020-01-02T03:04:05Z","message":"replayed"}`, line)
+			} else {
+				assert.Contains(t, line, `"time":`)
+				assert.NotContains(t, line, "2020-01-02")
+			}
+		}
+	})
+}
+
+func TestLogger_Emit(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	fields := map[string]interface{}{"user": "john", "amount": 42, "event": "other"}
+	l.Emit("checkout", fields)
+	l.Emit("login", nil)
+
+	assert.Equal(t, `{"level":"info","event":"checkout","amount":42,"user":"john"}
+{"level":"info","event":"login"}
+`, b.String())
+	assert.Equal(t, "other", fields["event"], "should not change the fields")
+}
+
+func TestLogger_EveryN(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+	heartbeat := func() {
+		l.EveryN(50 * time.Millisecond).Info("alive")
+	}
+
+	for i := 0; i < 10; i++ {
+		heartbeat()
+	}
+
+	assert.Equal(t, 1, strings.Count(b.String(), "alive"), "should log once within the interval")
+
+	loggers := make([]*lecho.Logger, 3)
+
+	for i := range loggers {
+		loggers[i] = l.EveryN(time.Hour)
+	}
+
+	assert.Same(t, l, loggers[0])
+	assert.NotSame(t, l, loggers[1])
+	assert.Same(t, loggers[1], loggers[2], "should share the discarding logger")
+
+	l.EveryN(50 * time.Millisecond).Print("other")
+
+	assert.Contains(t, b.String(), "other", "should track call sites separately")
+
+	time.Sleep(60 * time.Millisecond)
+	heartbeat()
+
+	assert.Equal(t, 2, strings.Count(b.String(), "alive"), "should log again after the interval")
+}
+
+func TestLogger_Timed(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	done := l.Timed(log.WARN, "db.query")
+	time.Sleep(20 * time.Millisecond)
+	done()
+
+	var record struct {
+		Level    string  `json:"level"`
+		Op       string  `json:"op"`
+		Duration float64 `json:"duration"`
+	}
+
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &record))
+	assert.Equal(t, "warn", record.Level)
+	assert.Equal(t, "db.query", record.Op)
+	assert.GreaterOrEqual(t, record.Duration, float64(20), "should log the duration in milliseconds")
+	assert.Less(t, record.Duration, float64(1000))
+}
+
+func TestLogger_Stack(t *testing.T) {
+	type Log struct {
+		Level   string `json:"level"`
+		Message string `json:"message"`
+		Stack   []struct {
+			Func   string `json:"func"`
+			Source string `json:"source"`
+		} `json:"stack"`
+	}
+
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithLevel(log.INFO))
+
+	l.Stack(log.WARN, "unexpected state")
+
+	entry := &Log{}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), entry))
+	assert.Equal(t, "warn", entry.Level)
+	assert.Equal(t, "unexpected state", entry.Message)
+
+	if assert.NotEmpty(t, entry.Stack) {
+		assert.Equal(t, "github.com/ziflex/lecho/v3_test.TestLogger_Stack", entry.Stack[0].Func)
+		assert.Equal(t, "logger_test.go", filepath.Base(entry.Stack[0].Source))
+	}
+
+	b.Reset()
+	l.Stack(log.DEBUG, "foo")
+
+	assert.Empty(t, b.String())
+}
+
+func TestLogger_If(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	type Cond struct {
+		Level zerolog.Level
+		Fn    func(cond bool) *lecho.ConditionalLogger
+	}
+
+	for _, c := range []Cond{
+		{Level: zerolog.DebugLevel, Fn: l.DebugIf},
+		{Level: zerolog.InfoLevel, Fn: l.InfoIf},
+		{Level: zerolog.WarnLevel, Fn: l.WarnIf},
+		{Level: zerolog.ErrorLevel, Fn: l.ErrorIf},
+	} {
+		b.Reset()
+
+		c.Fn(false).Msg("foo")
+		c.Fn(false).Msgf("foo%s", "bar")
+
+		assert.Empty(t, b.String())
+
+		c.Fn(true).Msg("foo")
+		c.Fn(true).Msgf("foo%s", "bar")
+
+		assert.Equal(t, fmt.Sprintf(`{"level":"%s","message":"foo"}
+{"level":"%s","message":"foobar"}
+`, c.Level, c.Level), b.String())
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		l.ErrorIf(false).Msg("foo")
+	})
+
+	assert.Zero(t, allocs)
+}
+
+func TestLogger_DebugEvery(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	for i := 0; i < 100; i++ {
+		l.DebugEvery(10, "foo")
+	}
+
+	assert.Equal(t, strings.Repeat(`{"level":"debug","message":"foo"}`+"\n", 10), b.String())
+
+	b.Reset()
+
+	for i := 0; i < 3; i++ {
+		l.DebugEvery(10, "bar")
+		l.DebugEvery(1, "baz")
+	}
+
+	assert.Equal(t, `{"level":"debug","message":"bar"}
+{"level":"debug","message":"baz"}
+{"level":"debug","message":"baz"}
+{"level":"debug","message":"baz"}
+`, b.String(), "should count each call site separately")
+}
+
 func TestLogger(t *testing.T) {
 	type (
 		SimpleLog struct {
@@ -1,9 +1,27 @@
 package lecho
 
 import (
+	"bytes"
 	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
 	"os"
+	"reflect"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -19,24 +37,176 @@ type (
 		Logger *Logger
 		// Skipper defines a function to skip middleware.
 		Skipper middleware.Skipper
+		// SkipPaths defines a list of routes or paths to skip. It is combined with Skipper.
+		SkipPaths []string
+		// SkipPreflight indicates whether to skip logging successful OPTIONS requests, such as CORS preflight requests.
+		SkipPreflight bool
 		// AfterNextSkipper defines a function to skip middleware after the next handler is called.
 		AfterNextSkipper middleware.Skipper
+		// SampleFunc returns the probability of a request to be logged. 1 always logs, 0 never does.
+		// Requests failing with an error or a 5xx status are always logged.
+		SampleFunc func(c echo.Context) float64
+		// SampleRand returns a pseudo-random number in [0.0,1.0) used with SampleFunc. Defaults to rand.Float64.
+		SampleRand func() float64
 		// BeforeNext is a function that is executed before the next handler is called.
 		BeforeNext middleware.BeforeFunc
+		// BeforeSend is a function that is executed right before the request log record is sent, after all other fields are added.
+		BeforeSend func(c echo.Context, evt *zerolog.Event, status int, latency time.Duration)
 		// Enricher is a function that can be used to enrich the logger with additional information.
+		// It is called again when the request logger re-applies its setters, e.g. on SetPrefix, Named or Fields.
 		Enricher Enricher
+		// MaxFields is the maximum number of fields the Enricher can add. Additional fields are dropped
+		// and fields_truncated is added. Not limited by default.
+		// The fields are copied once, when the request starts, so the time and caller fields added by the Enricher
+		// with Timestamp and Caller are dropped, use WithTimestamp and WithCaller instead.
+		MaxFields int
+		// UserExtractor is a function that extracts the authenticated user from the context after the next handler is called.
+		UserExtractor func(c echo.Context) (string, bool)
+		// DebugTraceHeader is the request header that, when set to DebugTraceSecret, logs that request at trace level
+		// along with its headers and a timing breakdown, and lowers the level of its logger to trace. Disabled by default.
+		// The values of RedactHeaders are redacted.
+		DebugTraceHeader string
+		// DebugTraceSecret is the value DebugTraceHeader must be set to. DebugTraceHeader is ignored without it,
+		// so clients cannot get their requests logged verbosely.
+		DebugTraceSecret string
+		// RedactHeaders defines the headers whose values are redacted when headers are logged, with DebugTraceHeader and SlowRequestDebug.
+		// Defaults to DefaultRedactHeaders.
+		RedactHeaders []string
+		// ProbeUserAgents defines the User-Agent prefixes of health-check probes, e.g. "kube-probe/".
+		// Requests made by probes are logged at debug level, unless the handler returns an error.
+		ProbeUserAgents []string
+		// WarmupDuration is the period after the middleware is created during which successful requests are logged at debug level,
+		// to reduce the noise of startup traffic such as readiness probes. Disabled by default.
+		WarmupDuration time.Duration
+		// GroupExtractor is a function that returns the route group of the request to log as group, e.g. DefaultGroupExtractor.
+		// Empty groups are omitted. Disabled by default.
+		GroupExtractor func(c echo.Context) string
+		// PathNormalizer is a function that returns the path of the request with its variable parts masked to log as normalized_path,
+		// e.g. DefaultPathNormalizer, for a low cardinality field when no route template is available, such as for static files.
+		// Disabled by default.
+		PathNormalizer func(path string) string
+		// LogClientCert indicates whether to log client_cert_subject and client_cert_serial, the subject common name
+		// and the serial number of the client certificate of mutual TLS requests. Both are omitted for other requests.
+		LogClientCert bool
+		// DetectBots indicates whether to log is_bot and bot_name derived from the User-Agent.
+		DetectBots bool
+		// BotDetector is a function that detects bots by User-Agent. Defaults to DefaultBotDetector.
+		BotDetector func(ua string) (name string, isBot bool)
+		// OmitNonBots indicates whether to omit is_bot for requests not made by bots.
+		OmitNonBots bool
+		// FingerprintHeaders defines the headers hashed along with the method and route into request_fingerprint.
+		// The fingerprint is not logged by default.
+		FingerprintHeaders []string
+		// IdempotencyHeader is the request header carrying the idempotency key, e.g. Idempotency-Key.
+		// The key is logged as idempotency_key_hash, a short SHA-256 hash, so the raw value never appears. Disabled by default.
+		IdempotencyHeader string
+		// CacheHeader is the response header indicating whether the response was served from cache. Disabled by default.
+		CacheHeader string
+		// CacheHitValue is the CacheHeader value indicating a cache hit. Defaults to "HIT".
+		CacheHitValue string
+		// SchemaVersion is the version of the log format to log as log_schema with every request,
+		// so consumers can branch on it. Use WithSchemaVersion instead to tag all records of the logger.
+		SchemaVersion string
+		// InstanceID is the identifier of the server instance to log with every request.
+		InstanceID string
+		// AutoInstanceID indicates whether to use the hostname, or a random identifier if it is unavailable, when InstanceID is empty.
+		AutoInstanceID bool
+		// GRPCStatusHeader is the response header carrying the gRPC status code, e.g. set by grpc-gateway. Disabled by default.
+		GRPCStatusHeader string
+		// ContextKeys defines the keys of echo context values to log in context_values.
+		ContextKeys []string
+		// ContextValueLimit is the maximum size of a serialized context value. Larger values are truncated. Defaults to 256.
+		ContextValueLimit int
 		// RequestIDHeader is the header name to use for the request ID in a log record.
+		// The ID is read from the request, then from the response. If both are empty, the response is checked again after the next handler,
+		// in which case the ID is added to the records written after it, but not to those logged by the handlers.
 		RequestIDHeader string
+		// FlagUnmatchedRoutes indicates whether to log requests not found by the router at warn level with unmatched_route,
+		// to spot scanners and misconfigured clients.
+		FlagUnmatchedRoutes bool
+		// LogIPMismatch indicates whether to log ip_spoof_suspect and peer_ip when the real IP is taken from
+		// the X-Forwarded-For or X-Real-IP header, but differs from the IP of a peer that is not a trusted proxy.
+		LogIPMismatch bool
+		// TrustedProxies defines the IPs or CIDR ranges of trusted proxies used with LogIPMismatch.
+		TrustedProxies []string
+		// RequestIDContextKey is the echo context key holding the request ID, used when neither the request nor the response has the RequestIDHeader.
+		RequestIDContextKey string
 		// RequestIDKey is the key name to use for the request ID in a log record.
 		RequestIDKey string
 		// NestKey is the key name to use for the nested logger in a log record.
 		NestKey string
 		// HandleError indicates whether to propagate errors up the middleware chain, so the global error handler can decide appropriate status code.
 		HandleError bool
+		// SeparateErrorLog indicates whether to log errors as a separate line, keeping the access line at the regular level.
+		// The error line has the stack of the error returned by zerolog.ErrorStackMarshaler, if set, as with WithStack.
+		SeparateErrorLog bool
+		// ErrorClassifier returns the category of an error, such as "timeout", "validation", "auth" or "internal",
+		// logged as error_category along with the error. The status is the one of the echo.HTTPError, if any, or of the response.
+		// An empty category is omitted. Errors are not classified by default.
+		ErrorClassifier func(err error, status int) string
 		// For long-running requests that take longer than this limit, log at a different level.  Ignored by default
 		RequestLatencyLimit time.Duration
 		// The level to log at if RequestLatencyLimit is exceeded
 		RequestLatencyLevel zerolog.Level
+		// SlowRequestDebug is the handler duration above which the request is logged again at debug level,
+		// with the request headers and the timing of the middleware, to capture details of slow requests only.
+		// The line is written even if the level of the logger is above debug. Disabled by default.
+		SlowRequestDebug time.Duration
+		// LatencyHumanPrecision is the precision to round latency_human to. No rounding by default.
+		LatencyHumanPrecision time.Duration
+		// LogWallLatency indicates whether to log latency_wall, the latency computed from wall clock readings,
+		// along with latency computed from monotonic ones. A large difference indicates a clock jump.
+		LogWallLatency bool
+		// Clock returns the current time used to measure requests. Defaults to time.Now.
+		Clock func() time.Time
+		// LatencyISO8601 indicates whether to log latency_iso, the latency formatted as an ISO8601 duration.
+		LatencyISO8601 bool
+		// ServerTimingField indicates whether to log server_timing, the latency in the Server-Timing header format, e.g. "total;dur=123.400".
+		ServerTimingField bool
+		// ServerTimingHeader indicates whether to add the Server-Timing response header.
+		// The header is measured when the response is committed, so it does not include the time spent after.
+		ServerTimingHeader bool
+		// LogInflight indicates whether to log inflight, the number of requests being served by the middleware, including the logged one.
+		LogInflight bool
+		// LogStartTime indicates whether to log request_start, the time the request started at formatted as RFC3339 with nanoseconds.
+		LogStartTime bool
+		// LogCORS indicates whether to log origin, the Origin request header, and cors_allowed, whether the Access-Control-Allow-Origin
+		// response header allows it. Both are omitted for requests without an Origin header.
+		LogCORS bool
+		// LogHTTP2Stream indicates whether to log http2_stream, the stream ID of HTTP/2 requests set with WithHTTP2StreamID.
+		// net/http does not expose stream IDs, so the field is omitted unless the server or a previous middleware provides it.
+		LogHTTP2Stream bool
+		// LogDeadline indicates whether to log deadline_remaining, the time left until the deadline of the request context
+		// when the request completes, negative if the deadline is exceeded. Omitted for requests without a deadline.
+		LogDeadline bool
+		// EnqueueTimeKey is the echo context key holding the time.Time the request was queued at, set by a middleware running before this one,
+		// such as a rate limiter. If set, wait_time, the time elapsed until the next handler was called, is logged.
+		EnqueueTimeKey string
+		// SubTimings maps log field names to echo context keys holding the time.Duration of sub-operations set by handlers,
+		// e.g. {"db_time": "db_duration"}. Absent keys are omitted.
+		SubTimings map[string]string
+		// LogTTFB indicates whether to log the time elapsed until the first byte of the response was written.
+		LogTTFB bool
+		// LogBodyContentTypes defines the request content types whose bodies are logged. Bodies are not logged by default.
+		LogBodyContentTypes []string
+		// LogBodyLimit is the maximum number of body bytes to log. Defaults to 1024.
+		LogBodyLimit int
+		// LogContentType indicates whether to log the request and response Content-Type headers.
+		LogContentType bool
+		// LogContentEncoding indicates whether to log the response Content-Encoding header, e.g. gzip.
+		LogContentEncoding bool
+		// LogSetCookieNames indicates whether to log the names of the cookies set by the response, without their values.
+		LogSetCookieNames bool
+		// LogHeaderStats indicates whether to log the number of request header lines and their total size in bytes, without their values.
+		LogHeaderStats bool
+		// LogMultipartMeta indicates whether to log the field names, file names and sizes of multipart uploads.
+		// The form is parsed after the next handler, only if the handler has not consumed it already,
+		// in which case its temporary files are removed once logged.
+		LogMultipartMeta bool
+		// MultipartMemory is the maximum number of bytes of a multipart form stored in memory. Defaults to 32 MB.
+		MultipartMemory int64
+		// LogRuntimeStatsOnSlow indicates whether to log the number of goroutines and heap in use when RequestLatencyLimit is exceeded.
+		LogRuntimeStatsOnSlow bool
 	}
 
 	// Enricher is a function that can be used to enrich the logger with additional information.
@@ -59,11 +229,27 @@ func (c *Context) Logger() echo.Logger {
 }
 
 // Middleware returns a middleware which logs HTTP requests.
+// It panics if the config is invalid, e.g. if TrustedProxies holds an invalid IP, use Config.ToMiddleware to get an error instead.
 func Middleware(config Config) echo.MiddlewareFunc {
+	mw, err := config.ToMiddleware()
+
+	if err != nil {
+		panic(err)
+	}
+
+	return mw
+}
+
+// ToMiddleware returns a middleware which logs HTTP requests, or an error if the config is invalid.
+func (config Config) ToMiddleware() (echo.MiddlewareFunc, error) {
 	if config.Skipper == nil {
 		config.Skipper = middleware.DefaultSkipper
 	}
 
+	if len(config.SkipPaths) > 0 {
+		config.Skipper = skipPaths(config.SkipPaths, config.Skipper)
+	}
+
 	if config.AfterNextSkipper == nil {
 		config.AfterNextSkipper = middleware.DefaultSkipper
 	}
@@ -80,16 +266,89 @@ func Middleware(config Config) echo.MiddlewareFunc {
 		config.RequestIDHeader = echo.HeaderXRequestID
 	}
 
+	if config.InstanceID == "" && config.AutoInstanceID {
+		config.InstanceID = instanceID()
+	}
+
+	if config.CacheHitValue == "" {
+		config.CacheHitValue = "HIT"
+	}
+
+	if config.BotDetector == nil {
+		config.BotDetector = DefaultBotDetector
+	}
+
+	if config.RedactHeaders == nil {
+		config.RedactHeaders = DefaultRedactHeaders
+	}
+
+	if config.ContextValueLimit <= 0 {
+		config.ContextValueLimit = 256
+	}
+
+	if config.MultipartMemory <= 0 {
+		config.MultipartMemory = 32 << 20
+	}
+
+	if config.SampleRand == nil {
+		config.SampleRand = rand.Float64
+	}
+
+	if config.Clock == nil {
+		config.Clock = time.Now
+	}
+
+	if config.LogBodyLimit <= 0 {
+		config.LogBodyLimit = 1024
+	}
+
+	trustedProxies := make([]*net.IPNet, 0, len(config.TrustedProxies))
+
+	for _, proxy := range config.TrustedProxies {
+		ipNet, err := parseCIDR(proxy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		trustedProxies = append(trustedProxies, ipNet)
+	}
+
+	// number of requests being served, including the current one
+	var inflight int64
+
+	warmupEnd := config.Clock().Add(config.WarmupDuration)
+
+	redacted := make(map[string]struct{}, len(config.RedactHeaders))
+
+	for _, name := range config.RedactHeaders {
+		redacted[http.CanonicalHeaderKey(name)] = struct{}{}
+	}
+
+	// sorted for a stable order of the fields
+	subTimings := make([]string, 0, len(config.SubTimings))
+
+	for field := range config.SubTimings {
+		subTimings = append(subTimings, field)
+	}
+
+	sort.Strings(subTimings)
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			if config.Skipper(c) {
 				return next(c)
 			}
 
+			if config.LogInflight {
+				atomic.AddInt64(&inflight, 1)
+				defer atomic.AddInt64(&inflight, -1)
+			}
+
 			var err error
 			req := c.Request()
 			res := c.Response()
-			start := time.Now()
+			start := config.Clock()
 
 			id := req.Header.Get(config.RequestIDHeader)
 
@@ -97,22 +356,46 @@ func Middleware(config Config) echo.MiddlewareFunc {
 				id = res.Header().Get(config.RequestIDHeader)
 			}
 
+			if id == "" && config.RequestIDContextKey != "" {
+				id, _ = c.Get(config.RequestIDContextKey).(string)
+			}
+
 			cloned := false
 			logger := config.Logger
 
 			if id != "" {
-				logger = From(logger.log, WithField(config.RequestIDKey, id))
+				logger = logger.derive(config.RequestIDKey, id)
 				cloned = true
 			}
 
 			if config.Enricher != nil {
+				ec := c
+				enrich := func(ctx zerolog.Context) zerolog.Context {
+					if config.MaxFields > 0 {
+						return enrichLimited(ec, config.Enricher, ctx, config.MaxFields)
+					}
+
+					return config.Enricher(ec, ctx)
+				}
+
+				// the enricher is kept as a setter, so its fields are not lost when the request logger is rebuilt, e.g. by SetPrefix
+				logger = logger.extend(func(opts *Options) {
+					opts.context = enrich(opts.context)
+				}, enrich)
+				cloned = true
+			}
+
+			debugTrace := config.DebugTraceHeader != "" && config.DebugTraceSecret != "" &&
+				subtle.ConstantTimeCompare([]byte(req.Header.Get(config.DebugTraceHeader)), []byte(config.DebugTraceSecret)) == 1
+
+			if debugTrace {
 				// to avoid mutation of shared instance
 				if !cloned {
-					logger = From(logger.log)
+					logger = logger.clone()
 					cloned = true
 				}
 
-				logger.log = config.Enricher(c, logger.log.With()).Logger()
+				logger.setZeroLevel(zerolog.TraceLevel)
 			}
 
 			ctx := req.Context()
@@ -121,6 +404,29 @@ func Middleware(config Config) echo.MiddlewareFunc {
 				ctx = context.Background()
 			}
 
+			var body []byte
+
+			if len(config.LogBodyContentTypes) > 0 && req.Body != nil && matchContentType(req, config.LogBodyContentTypes) {
+				body, req.Body = captureBody(req.Body, config.LogBodyLimit)
+			}
+
+			var ttfb *ttfbWriter
+
+			if config.LogTTFB {
+				ttfb = &ttfbWriter{ResponseWriter: res.Writer, clock: config.Clock}
+				res.Writer = ttfb.wrap()
+
+				defer func() {
+					res.Writer = ttfb.ResponseWriter
+				}()
+			}
+
+			if config.ServerTimingHeader {
+				res.Before(func() {
+					res.Header().Add("Server-Timing", serverTiming(config.Clock().Sub(start)))
+				})
+			}
+
 			// Pass logger down to request context
 			c.SetRequest(req.WithContext(logger.WithContext(ctx)))
 			c = NewContext(c, logger)
@@ -129,6 +435,8 @@ func Middleware(config Config) echo.MiddlewareFunc {
 				config.BeforeNext(c)
 			}
 
+			nextStart := config.Clock()
+
 			if err = next(c); err != nil {
 				if config.HandleError {
 					c.Error(err)
@@ -139,15 +447,54 @@ func Middleware(config Config) echo.MiddlewareFunc {
 				return err
 			}
 
-			stop := time.Now()
+			if config.SkipPreflight && req.Method == http.MethodOptions && err == nil && res.Status < http.StatusBadRequest {
+				return err
+			}
+
+			if config.SampleFunc != nil && err == nil && res.Status < http.StatusInternalServerError &&
+				!sampled(config.SampleFunc(c), config.SampleRand) {
+				return err
+			}
+
+			stop := config.Clock()
 			latency := stop.Sub(start)
+			slow := config.RequestLatencyLimit != 0 && latency > config.RequestLatencyLimit
+			unmatched := config.FlagUnmatchedRoutes && unmatchedRoute(c, err)
+			warmup := config.WarmupDuration > 0 && stop.Before(warmupEnd) && res.Status < http.StatusBadRequest
+
+			// the id can be set to the response by a downstream middleware
+			if id == "" {
+				if id = res.Header().Get(config.RequestIDHeader); id != "" {
+					logger = logger.derive(config.RequestIDKey, id)
+				}
+			}
+
 			var mainEvt *zerolog.Event
-			if err != nil {
-				mainEvt = logger.log.Err(err)
-			} else if config.RequestLatencyLimit != 0 && latency > config.RequestLatencyLimit {
-				mainEvt = logger.log.WithLevel(config.RequestLatencyLevel)
+			if unmatched {
+				mainEvt = logger.withLevel(zerolog.WarnLevel)
+
+				if err != nil && !config.SeparateErrorLog {
+					mainEvt = logger.withError(mainEvt, err)
+				}
+			} else if err != nil && !config.SeparateErrorLog {
+				mainEvt = logger.errEvent(err)
+			} else if debugTrace {
+				mainEvt = logger.withLevel(zerolog.TraceLevel)
+			} else if warmup || isProbe(req.UserAgent(), config.ProbeUserAgents) {
+				mainEvt = logger.withLevel(zerolog.DebugLevel)
+			} else if slow {
+				mainEvt = logger.withLevel(config.RequestLatencyLevel)
 			} else {
-				mainEvt = logger.log.WithLevel(logger.log.GetLevel())
+				mainEvt = logger.withLevel(logger.logger().GetLevel())
+			}
+
+			var category string
+			if err != nil && config.ErrorClassifier != nil {
+				category = config.ErrorClassifier(err, errorStatus(c, err))
+			}
+
+			if category != "" && !config.SeparateErrorLog {
+				mainEvt.Str("error_category", category)
 			}
 
 			var evt *zerolog.Event
@@ -157,15 +504,105 @@ func Middleware(config Config) echo.MiddlewareFunc {
 				evt = mainEvt
 			}
 
+			if config.SchemaVersion != "" {
+				evt.Str(SchemaVersionFieldName, config.SchemaVersion)
+			}
+
+			if config.InstanceID != "" {
+				evt.Str("instance", config.InstanceID)
+			}
+
 			evt.Str("remote_ip", c.RealIP())
+
+			if unmatched {
+				evt.Bool("unmatched_route", true)
+			}
+
+			if config.LogIPMismatch {
+				if peer, suspect := spoofSuspect(c, trustedProxies); suspect {
+					evt.Bool("ip_spoof_suspect", true)
+					evt.Str("peer_ip", peer)
+				}
+			}
 			evt.Str("host", req.Host)
 			evt.Str("method", req.Method)
 			evt.Str("uri", req.RequestURI)
 			evt.Str("user_agent", req.UserAgent())
 			evt.Int("status", res.Status)
+
+			if config.GRPCStatusHeader != "" {
+				if status := res.Header().Get(config.GRPCStatusHeader); status != "" {
+					if code, err := strconv.Atoi(status); err == nil {
+						evt.Int("grpc_status", code)
+					} else {
+						evt.Str("grpc_status", status)
+					}
+				}
+			}
+
 			evt.Str("referer", req.Referer())
+
+			if config.LogCORS {
+				if origin := req.Header.Get(echo.HeaderOrigin); origin != "" {
+					allowed := res.Header().Get(echo.HeaderAccessControlAllowOrigin)
+
+					evt.Str("origin", origin)
+					evt.Bool("cors_allowed", allowed == "*" || allowed == origin)
+				}
+			}
+
 			evt.Dur("latency", latency)
-			evt.Str("latency_human", latency.String())
+
+			if config.LatencyHumanPrecision > 0 {
+				evt.Str("latency_human", latency.Round(config.LatencyHumanPrecision).String())
+			} else {
+				evt.Str("latency_human", latency.String())
+			}
+
+			if config.LogWallLatency {
+				// Round(0) strips the monotonic clock reading
+				evt.Dur("latency_wall", stop.Round(0).Sub(start.Round(0)))
+			}
+
+			if config.LatencyISO8601 {
+				evt.Str("latency_iso", FormatISO8601Duration(latency))
+			}
+
+			if config.ServerTimingField {
+				evt.Str("server_timing", serverTiming(latency))
+			}
+
+			if config.LogInflight {
+				evt.Int64("inflight", atomic.LoadInt64(&inflight))
+			}
+
+			if config.LogStartTime {
+				evt.Str("request_start", start.Format(time.RFC3339Nano))
+			}
+
+			if config.EnqueueTimeKey != "" {
+				if enqueued, ok := c.Get(config.EnqueueTimeKey).(time.Time); ok {
+					evt.Dur("wait_time", nextStart.Sub(enqueued))
+				}
+			}
+
+			if config.LogHTTP2Stream && req.ProtoMajor == 2 {
+				if id, ok := HTTP2StreamID(req.Context()); ok {
+					evt.Uint32("http2_stream", id)
+				}
+			}
+
+			for _, field := range subTimings {
+				if d, ok := c.Get(config.SubTimings[field]).(time.Duration); ok {
+					evt.Dur(field, d)
+				}
+			}
+
+			if config.LogDeadline {
+				if deadline, ok := req.Context().Deadline(); ok {
+					evt.Dur("deadline_remaining", deadline.Sub(stop))
+				}
+			}
 
 			cl := req.Header.Get(echo.HeaderContentLength)
 			if cl == "" {
@@ -175,12 +612,659 @@ func Middleware(config Config) echo.MiddlewareFunc {
 			evt.Str("bytes_in", cl)
 			evt.Str("bytes_out", strconv.FormatInt(res.Size, 10))
 
+			if config.LogContentEncoding {
+				if ce := res.Header().Get(echo.HeaderContentEncoding); ce != "" {
+					evt.Str("content_encoding", ce)
+				}
+			}
+
+			if config.LogSetCookieNames {
+				if names := cookieNames(res.Header()); len(names) > 0 {
+					evt.Strs("set_cookies", names)
+				}
+			}
+
+			if config.LogContentType {
+				if ct := req.Header.Get(echo.HeaderContentType); ct != "" {
+					evt.Str("request_content_type", ct)
+				}
+
+				if ct := res.Header().Get(echo.HeaderContentType); ct != "" {
+					evt.Str("response_content_type", ct)
+				}
+			}
+
+			if body != nil {
+				evt.Bytes("body", body)
+			}
+
+			if ttfb != nil && !ttfb.first.IsZero() {
+				evt.Dur("ttfb", ttfb.first.Sub(start))
+			}
+
+			if config.CacheHeader != "" {
+				evt.Bool("cache_hit", strings.EqualFold(res.Header().Get(config.CacheHeader), config.CacheHitValue))
+			}
+
+			if config.DetectBots {
+				if name, isBot := config.BotDetector(req.UserAgent()); isBot {
+					evt.Bool("is_bot", true)
+					evt.Str("bot_name", name)
+				} else if !config.OmitNonBots {
+					evt.Bool("is_bot", false)
+				}
+			}
+
+			if len(config.FingerprintHeaders) > 0 {
+				evt.Str("request_fingerprint", fingerprint(c, config.FingerprintHeaders))
+			}
+
+			if config.IdempotencyHeader != "" {
+				if key := req.Header.Get(config.IdempotencyHeader); key != "" {
+					evt.Str("idempotency_key_hash", shortHash(key))
+				}
+			}
+
+			if config.LogHeaderStats {
+				count, size := headerStats(req.Header)
+
+				evt.Int("header_count", count)
+				evt.Int("header_bytes", size)
+			}
+
+			if config.LogMultipartMeta {
+				if files := multipartFiles(c.Request(), config.MultipartMemory); files != nil {
+					evt.Array("uploads", files)
+				}
+			}
+
+			if len(config.ContextKeys) > 0 {
+				if values := contextValues(c, config.ContextKeys, config.ContextValueLimit); values != nil {
+					evt.Dict("context_values", values)
+				}
+			}
+
+			if config.GroupExtractor != nil {
+				if group := config.GroupExtractor(c); group != "" {
+					evt.Str("group", group)
+				}
+			}
+
+			if config.PathNormalizer != nil {
+				evt.Str("normalized_path", config.PathNormalizer(req.URL.Path))
+			}
+
+			if config.UserExtractor != nil {
+				if user, ok := config.UserExtractor(c); ok {
+					evt.Str("user", user)
+				}
+			}
+
+			if config.LogClientCert && req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+				cert := req.TLS.PeerCertificates[0]
+
+				evt.Str("client_cert_subject", cert.Subject.CommonName)
+
+				if cert.SerialNumber != nil {
+					evt.Str("client_cert_serial", cert.SerialNumber.String())
+				}
+			}
+
+			// ReadMemStats stops the world, so it is only called for slow requests.
+			if slow && config.LogRuntimeStatsOnSlow {
+				var mem runtime.MemStats
+				runtime.ReadMemStats(&mem)
+
+				evt.Int("goroutines", runtime.NumGoroutine())
+				evt.Uint64("heap_inuse", mem.HeapInuse)
+			}
+
+			if debugTrace {
+				evt.Dict("headers", headersDict(req.Header, redacted))
+				evt.Dict("timing", zerolog.Dict().
+					Dur("setup", nextStart.Sub(start)).
+					Dur("handler", stop.Sub(nextStart)))
+			}
+
 			if config.NestKey != "" { // Nest the new event (dict) under the nest key.
 				mainEvt.Dict(config.NestKey, evt)
 			}
+
+			if config.BeforeSend != nil {
+				config.BeforeSend(c, mainEvt, res.Status, latency)
+			}
+
 			mainEvt.Send()
 
+			if config.SlowRequestDebug > 0 && stop.Sub(nextStart) > config.SlowRequestDebug {
+				// the line captures details when debug logging is off, so the level of the logger is lowered for it
+				zl := logger.logger()
+
+				if zl.GetLevel() > zerolog.DebugLevel {
+					zl = zl.Level(zerolog.DebugLevel)
+				}
+
+				zl.Debug().
+					Str("method", req.Method).
+					Str("uri", req.RequestURI).
+					Int("status", res.Status).
+					Dict("headers", headersDict(req.Header, redacted)).
+					Dict("timing", zerolog.Dict().
+						Dur("setup", nextStart.Sub(start)).
+						Dur("handler", stop.Sub(nextStart))).
+					Msg("slow request")
+			}
+
+			if err != nil && config.SeparateErrorLog {
+				errEvt := logger.event((*zerolog.Logger).Error)
+
+				// the stack is added by withError with WithStack
+				if opts := logger.options(); !opts.stack && errEvt.Enabled() {
+					errEvt = errorStack(errEvt, err, opts.stackSkip)
+				}
+
+				errEvt = logger.withError(errEvt, err)
+
+				if category != "" {
+					errEvt.Str("error_category", category)
+				}
+
+				errEvt.Send()
+			}
+
 			return err
 		}
+	}, nil
+}
+
+func skipPaths(paths []string, skipper middleware.Skipper) middleware.Skipper {
+	set := make(map[string]struct{}, len(paths))
+
+	for _, p := range paths {
+		set[p] = struct{}{}
+	}
+
+	return func(c echo.Context) bool {
+		if _, found := set[c.Path()]; found {
+			return true
+		}
+
+		if _, found := set[c.Request().URL.Path]; found {
+			return true
+		}
+
+		return skipper(c)
+	}
+}
+
+// fingerprint returns a hex encoded FNV hash of the request method, route and given headers.
+func fingerprint(c echo.Context, headers []string) string {
+	req := c.Request()
+	route := c.Path()
+
+	if route == "" {
+		route = req.URL.Path
+	}
+
+	h := fnv.New64a()
+	_, _ = io.WriteString(h, req.Method)
+	_, _ = h.Write([]byte{0})
+	_, _ = io.WriteString(h, route)
+
+	for _, name := range headers {
+		_, _ = h.Write([]byte{0})
+		_, _ = io.WriteString(h, req.Header.Get(name))
+	}
+
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// shortHash returns the first 8 bytes of the SHA-256 hash of the value, hex encoded.
+func shortHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// headerStats returns the number of header lines and their size as "Name: value\r\n".
+func headerStats(header http.Header) (int, int) {
+	var count, size int
+
+	for name, values := range header {
+		for _, value := range values {
+			count++
+			size += len(name) + len(value) + 4
+		}
+	}
+
+	return count, size
+}
+
+// multipartFile holds the metadata of the uploaded file.
+type multipartFile struct {
+	field    string
+	filename string
+	size     int64
+}
+
+func (f multipartFile) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("field", f.field)
+	e.Str("filename", f.filename)
+	e.Int64("size", f.size)
+}
+
+// multipartFiles returns the metadata of the files uploaded with a multipart request.
+func multipartFiles(req *http.Request, maxMemory int64) *zerolog.Array {
+	if !matchContentType(req, []string{echo.MIMEMultipartForm}) {
+		return nil
+	}
+
+	if req.MultipartForm == nil {
+		if err := req.ParseMultipartForm(maxMemory); err != nil {
+			return nil
+		}
+
+		// the form is parsed for logging only, so its temporary files are not left behind
+		form := req.MultipartForm
+
+		defer func() {
+			_ = form.RemoveAll()
+		}()
+	}
+
+	if req.MultipartForm == nil || len(req.MultipartForm.File) == 0 {
+		return nil
+	}
+
+	fields := make([]string, 0, len(req.MultipartForm.File))
+
+	for field := range req.MultipartForm.File {
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	arr := zerolog.Arr()
+
+	for _, field := range fields {
+		for _, fh := range req.MultipartForm.File[field] {
+			arr.Object(multipartFile{
+				field:    field,
+				filename: fh.Filename,
+				size:     fh.Size,
+			})
+		}
+	}
+
+	return arr
+}
+
+// enrichLimited applies the enricher to a blank context and copies at most max of the added fields to ctx.
+// The time and caller fields are skipped, since their values would be those of the blank record.
+func enrichLimited(c echo.Context, enricher Enricher, ctx zerolog.Context, max int) zerolog.Context {
+	buf := &bytes.Buffer{}
+	blank := enricher(c, zerolog.New(buf).With()).Logger()
+	blank.Log().Send()
+
+	dec := json.NewDecoder(buf)
+
+	if _, err := dec.Token(); err != nil {
+		return ctx
+	}
+
+	var count int
+
+	for dec.More() {
+		key, err := dec.Token()
+
+		if err != nil {
+			break
+		}
+
+		var value json.RawMessage
+
+		if err := dec.Decode(&value); err != nil {
+			break
+		}
+
+		if key == zerolog.TimestampFieldName || key == zerolog.CallerFieldName {
+			continue
+		}
+
+		if count == max {
+			return ctx.Bool("fields_truncated", true)
+		}
+
+		ctx = ctx.RawJSON(key.(string), value)
+		count++
+	}
+
+	return ctx
+}
+
+// errorStatus returns the status of err if it is an echo.HTTPError, or the status of the response.
+func errorStatus(c echo.Context, err error) int {
+	if he, ok := err.(*echo.HTTPError); ok {
+		return he.Code
+	}
+
+	return c.Response().Status
+}
+
+// unmatchedRoute reports whether the request is not found because its path matches no registered route.
+// The router can set the path to the closest route, so the handler it found is checked instead:
+// the default not found handler, or the handler of a route registered with echo.Echo.RouteNotFound.
+func unmatchedRoute(c echo.Context, err error) bool {
+	if errorStatus(c, err) != http.StatusNotFound {
+		return false
+	}
+
+	path := c.Path()
+
+	if path == "" || c.Handler() == nil {
+		return true
+	}
+
+	if reflect.ValueOf(c.Handler()).Pointer() == reflect.ValueOf(echo.NotFoundHandler).Pointer() {
+		return true
+	}
+
+	if c.Echo() == nil {
+		return false
+	}
+
+	notFound := false
+
+	for _, route := range c.Echo().Routes() {
+		if route.Path != path {
+			continue
+		}
+
+		if route.Method == c.Request().Method {
+			return false
+		}
+
+		notFound = notFound || route.Method == echo.RouteNotFound
+	}
+
+	return notFound
+}
+
+// parseCIDR parses an IP or a CIDR range.
+func parseCIDR(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+
+		if ip == nil {
+			return nil, fmt.Errorf("lecho: invalid trusted proxy: %q", value)
+		}
+
+		bits := 8 * net.IPv6len
+
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+			bits = 8 * net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(value)
+
+	if err != nil {
+		return nil, fmt.Errorf("lecho: invalid trusted proxy: %w", err)
+	}
+
+	return ipNet, nil
+}
+
+// spoofSuspect returns the IP of the peer and whether the real IP taken from a header differs from it
+// while the peer is not a trusted proxy.
+func spoofSuspect(c echo.Context, trusted []*net.IPNet) (string, bool) {
+	req := c.Request()
+
+	if req.Header.Get(echo.HeaderXForwardedFor) == "" && req.Header.Get(echo.HeaderXRealIP) == "" {
+		return "", false
+	}
+
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+
+	if c.RealIP() == peer {
+		return peer, false
+	}
+
+	if ip := net.ParseIP(peer); ip != nil {
+		for _, ipNet := range trusted {
+			if ipNet.Contains(ip) {
+				return peer, false
+			}
+		}
+	}
+
+	return peer, true
+}
+
+// cookieNames returns the names of the cookies set by the Set-Cookie headers.
+func cookieNames(header http.Header) []string {
+	if len(header.Values(echo.HeaderSetCookie)) == 0 {
+		return nil
+	}
+
+	cookies := (&http.Response{Header: header}).Cookies()
+	names := make([]string, len(cookies))
+
+	for i, cookie := range cookies {
+		names[i] = cookie.Name
+	}
+
+	return names
+}
+
+// DefaultRedactHeaders holds the headers carrying credentials, whose values are redacted by default.
+var DefaultRedactHeaders = []string{
+	echo.HeaderAuthorization,
+	echo.HeaderCookie,
+	echo.HeaderSetCookie,
+	"Proxy-Authorization",
+	"X-Api-Key",
+	"X-Auth-Token",
+	"X-Csrf-Token",
+	"X-Amz-Security-Token",
+}
+
+// headersDict returns the headers as a dictionary, with the values of the redacted headers replaced.
+func headersDict(header http.Header, redacted map[string]struct{}) *zerolog.Event {
+	dict := zerolog.Dict()
+	names := make([]string, 0, len(header))
+
+	for name := range header {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, found := redacted[http.CanonicalHeaderKey(name)]; found {
+			dict.Str(name, "[REDACTED]")
+		} else {
+			dict.Strs(name, header[name])
+		}
+	}
+
+	return dict
+}
+
+// isProbe reports whether the User-Agent starts with one of the probe prefixes.
+func isProbe(ua string, probes []string) bool {
+	for _, p := range probes {
+		if strings.HasPrefix(ua, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serverTiming formats the duration as a Server-Timing metric, in milliseconds.
+func serverTiming(d time.Duration) string {
+	return "total;dur=" + strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// instanceID returns the hostname or a random identifier if it is unavailable.
+func instanceID() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+
+	id := make([]byte, 16)
+	_, _ = crand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// contextValues returns a dict with the serialized echo context values. Nil values are omitted.
+func contextValues(c echo.Context, keys []string, limit int) *zerolog.Event {
+	var dict *zerolog.Event
+
+	for _, key := range keys {
+		val := c.Get(key)
+
+		if val == nil {
+			continue
+		}
+
+		if dict == nil {
+			dict = zerolog.Dict()
+		}
+
+		switch v := val.(type) {
+		case string:
+			dict.Str(key, truncate(v, limit))
+		case error:
+			dict.Str(key, truncate(v.Error(), limit))
+		case fmt.Stringer:
+			dict.Str(key, truncate(v.String(), limit))
+		default:
+			data, err := json.Marshal(v)
+
+			if err != nil {
+				dict.Str(key, truncate(fmt.Sprintf("%v", v), limit))
+			} else if len(data) > limit {
+				dict.Str(key, truncate(string(data), limit))
+			} else {
+				dict.RawJSON(key, data)
+			}
+		}
+	}
+
+	return dict
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+
+	return s[:limit] + "..."
+}
+
+func sampled(probability float64, random func() float64) bool {
+	if probability >= 1 {
+		return true
+	}
+
+	if probability <= 0 {
+		return false
+	}
+
+	return random() < probability
+}
+
+func matchContentType(req *http.Request, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get(echo.HeaderContentType))
+
+	if err != nil {
+		return false
+	}
+
+	for _, t := range types {
+		if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// captureBody reads up to limit bytes of the body and returns them along with a body that still yields the full content.
+func captureBody(body io.ReadCloser, limit int) ([]byte, io.ReadCloser) {
+	captured, _ := io.ReadAll(io.LimitReader(body, int64(limit)))
+
+	return captured, struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.MultiReader(bytes.NewReader(captured), body),
+		Closer: body,
+	}
+}
+
+// ttfbWriter records the time of the first write to the response.
+type ttfbWriter struct {
+	http.ResponseWriter
+	clock func() time.Time
+	first time.Time
+}
+
+func (w *ttfbWriter) WriteHeader(code int) {
+	w.touch()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *ttfbWriter) Write(b []byte) (int, error) {
+	w.touch()
+
+	return w.ResponseWriter.Write(b)
+}
+
+// wrap returns w implementing http.Flusher and http.Hijacker only if the wrapped writer does,
+// so handlers checking for them keep their fallbacks.
+func (w *ttfbWriter) wrap() http.ResponseWriter {
+	f, flusher := w.ResponseWriter.(http.Flusher)
+	h, hijacker := w.ResponseWriter.(http.Hijacker)
+
+	switch {
+	case flusher && hijacker:
+		return struct {
+			*ttfbWriter
+			http.Flusher
+			http.Hijacker
+		}{w, f, h}
+	case flusher:
+		return struct {
+			*ttfbWriter
+			http.Flusher
+		}{w, f}
+	case hijacker:
+		return struct {
+			*ttfbWriter
+			http.Hijacker
+		}{w, h}
+	default:
+		return w
+	}
+}
+
+func (w *ttfbWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *ttfbWriter) touch() {
+	if w.first.IsZero() {
+		w.first = w.clock()
 	}
 }
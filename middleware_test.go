@@ -2,13 +2,26 @@ package lecho_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
@@ -101,66 +114,2049 @@ func TestMiddleware(t *testing.T) {
 		assert.Contains(t, str, `"test":"test"`)
 	})
 
+	t.Run("should keep the enricher fields when the request logger is rebuilt", func(t *testing.T) {
+		for _, maxFields := range []int{0, 5} {
+			e := echo.New()
+			b := &bytes.Buffer{}
+			m := lecho.Middleware(lecho.Config{
+				Logger:    lecho.New(b),
+				MaxFields: maxFields,
+				Enricher: func(c echo.Context, logger zerolog.Context) zerolog.Context {
+					return logger.Str("tenant", "acme")
+				},
+			})
+
+			handler := m(func(c echo.Context) error {
+				c.Logger().SetPrefix("p")
+				c.Logger().(*lecho.Logger).Named("handler").Info("named")
+
+				return c.NoContent(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderXRequestID, "123")
+			err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+			assert.NoError(t, err, "should not return error")
+
+			lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+
+			if assert.Len(t, lines, 2) {
+				assert.Contains(t, lines[0], `"id":"123","tenant":"acme","prefix":"p","logger":"handler"`)
+				assert.Contains(t, lines[1], `"id":"123","tenant":"acme","prefix":"p"`)
+				assert.Contains(t, lines[1], `"status":200`)
+			}
+		}
+	})
+
+	t.Run("should limit fields added by enricher", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:    lecho.New(b),
+			MaxFields: 2,
+			Enricher: func(c echo.Context, logger zerolog.Context) zerolog.Context {
+				for i := 0; i < 100; i++ {
+					logger = logger.Int(fmt.Sprintf("field_%d", i), i)
+				}
+
+				return logger
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderXRequestID, "123")
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		str := b.String()
+		assert.Contains(t, str, `"id":"123","field_0":0,"field_1":1,"fields_truncated":true`)
+		assert.NotContains(t, str, `"field_2"`)
+	})
+
+	t.Run("should not mark fields within the limit as truncated", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:    lecho.New(b),
+			MaxFields: 2,
+			Enricher: func(c echo.Context, logger zerolog.Context) zerolog.Context {
+				return logger.Str("foo", "bar").Dict("baz", zerolog.Dict().Int("qux", 1))
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		str := b.String()
+		assert.Contains(t, str, `"foo":"bar","baz":{"qux":1}`)
+		assert.NotContains(t, str, `"fields_truncated"`)
+	})
+
+	t.Run("should drop time and caller added by a limited enricher", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:    lecho.New(b),
+			MaxFields: 1,
+			Enricher: func(c echo.Context, logger zerolog.Context) zerolog.Context {
+				return logger.Timestamp().Caller().Str("foo", "bar")
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		str := b.String()
+		assert.Contains(t, str, `"foo":"bar"`)
+		assert.NotContains(t, str, `"time"`)
+		assert.NotContains(t, str, `"caller"`)
+		assert.NotContains(t, str, `"fields_truncated"`)
+	})
+
+	t.Run("should call BeforeSend after all fields are added", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:  lecho.New(b),
+			NestKey: "request",
+			BeforeSend: func(c echo.Context, evt *zerolog.Event, status int, latency time.Duration) {
+				evt.Bool("failed", status >= http.StatusInternalServerError)
+				evt.Bool("has_latency", latency >= 0)
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusServiceUnavailable)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		str := b.String()
+		assert.Contains(t, str, `"status":503`)
+		assert.Contains(t, str, `},"failed":true,"has_latency":true}`)
+	})
+
+	t.Run("should log request and response content types", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			LogContentType: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.JSON(http.StatusOK, map[string]string{"foo": "bar"})
+		})
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"foo":"bar"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		str := b.String()
+		assert.Contains(t, str, `"request_content_type":"application/json"`)
+		assert.Contains(t, str, `"response_content_type":"application/json; charset=UTF-8"`)
+	})
+
+	t.Run("should omit empty content types", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			LogContentType: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.NotContains(t, b.String(), "content_type")
+	})
+
+	t.Run("should log request start time", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:       lecho.New(b, lecho.WithTimestamp()),
+			LogStartTime: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			time.Sleep(10 * time.Millisecond)
+
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		var record struct {
+			Time         time.Time `json:"time"`
+			RequestStart time.Time `json:"request_start"`
+		}
+
+		assert.NoError(t, json.Unmarshal(b.Bytes(), &record))
+		assert.False(t, record.RequestStart.IsZero())
+		assert.False(t, record.RequestStart.Truncate(time.Second).After(record.Time), "request_start should precede time")
+	})
+
+	t.Run("should use request id from context", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:              lecho.New(b),
+			RequestIDContextKey: "request_id",
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		c := e.NewContext(req, httptest.NewRecorder())
+		c.Set("request_id", "ctx-123")
+
+		assert.NoError(t, handler(c), "should not return error")
+		assert.Contains(t, b.String(), `"id":"ctx-123"`)
+
+		b.Reset()
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		rec.Header().Set(echo.HeaderXRequestID, "res-123")
+		c = e.NewContext(req, rec)
+		c.Set("request_id", "ctx-123")
+
+		assert.NoError(t, handler(c), "should not return error")
+		assert.Contains(t, b.String(), `"id":"res-123"`, "should prefer the response header")
+	})
+
+	t.Run("should log latency in Server-Timing format", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:             lecho.New(b),
+			ServerTimingField:  true,
+			ServerTimingHeader: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			time.Sleep(5 * time.Millisecond)
+
+			return c.NoContent(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		err := handler(e.NewContext(req, rec))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Regexp(t, `"server_timing":"total;dur=\d+\.\d{3}"`, b.String())
+		assert.Regexp(t, `^total;dur=\d+\.\d{3}$`, rec.Header().Get("Server-Timing"))
+	})
+
+	t.Run("should skip successful preflight requests", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:        lecho.New(b),
+			SkipPreflight: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			if c.Request().Method == http.MethodOptions {
+				return c.NoContent(http.StatusNoContent)
+			}
+
+			return c.NoContent(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodOptions, "/", nil)
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Empty(t, b.String())
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Contains(t, b.String(), `"method":"GET"`)
+
+		b.Reset()
+
+		failing := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusForbidden)
+		})
+		req = httptest.NewRequest(http.MethodOptions, "/", nil)
+		assert.NoError(t, failing(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Contains(t, b.String(), `"status":403`, "should log failed preflight requests")
+	})
+
+	t.Run("should downgrade log level for probes", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:          lecho.New(b, lecho.WithLevel(log.DEBUG)),
+			ProbeUserAgents: []string{"kube-probe/"},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusServiceUnavailable)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", "kube-probe/1.27")
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Contains(t, b.String(), `{"level":"debug"`)
+
+		b.Reset()
+
+		m = lecho.Middleware(lecho.Config{
+			Logger:          lecho.New(b, lecho.WithLevel(log.INFO)),
+			ProbeUserAgents: []string{"kube-probe/"},
+		})
+		handler = m(func(c echo.Context) error {
+			return c.NoContent(http.StatusServiceUnavailable)
+		})
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", "kube-probe/1.27")
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Empty(t, b.String())
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", "curl/8.0")
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Contains(t, b.String(), `{"level":"info"`)
+	})
+
+	t.Run("should use request id set to response by downstream middleware", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger: lecho.New(b),
+		})
+		downstream := func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Response().Header().Set(echo.HeaderXRequestID, "downstream-123")
+
+				return next(c)
+			}
+		}
+
+		handler := m(downstream(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"id":"downstream-123","remote_ip"`)
+	})
+
+	t.Run("should add request id set to response by downstream middleware to the error line", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:           lecho.New(b),
+			SeparateErrorLog: true,
+		})
+		downstream := func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				c.Response().Header().Set(echo.HeaderXRequestID, "downstream-123")
+
+				return next(c)
+			}
+		}
+
+		handler := m(downstream(func(c echo.Context) error {
+			return errors.New("error")
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.Error(t, err, "should return error")
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+
+		assert.Len(t, lines, 2)
+
+		for _, line := range lines {
+			assert.Contains(t, line, `"id":"downstream-123"`)
+		}
+	})
+
+	t.Run("should log ip mismatch for untrusted peers", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			LogIPMismatch:  true,
+			TrustedProxies: []string{"10.0.0.0/8", "192.168.1.1"},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		req.Header.Set(echo.HeaderXForwardedFor, "1.2.3.4")
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Contains(t, b.String(), `"remote_ip":"1.2.3.4","ip_spoof_suspect":true,"peer_ip":"203.0.113.7"`)
+
+		for _, peer := range []string{"10.1.2.3:1234", "192.168.1.1:1234"} {
+			b.Reset()
+
+			req = httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = peer
+			req.Header.Set(echo.HeaderXForwardedFor, "1.2.3.4")
+			assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+			assert.NotContains(t, b.String(), "ip_spoof_suspect", peer)
+		}
+
+		b.Reset()
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.NotContains(t, b.String(), "ip_spoof_suspect", "should ignore direct requests")
+	})
+
+	t.Run("should reject invalid trusted proxies", func(t *testing.T) {
+		for _, proxy := range []string{"10.0.0.0/33", "localhost"} {
+			config := lecho.Config{
+				LogIPMismatch:  true,
+				TrustedProxies: []string{"10.0.0.0/8", proxy},
+			}
+
+			m, err := config.ToMiddleware()
+
+			assert.Error(t, err, proxy)
+			assert.Nil(t, m)
+			assert.Panics(t, func() {
+				lecho.Middleware(config)
+			}, proxy)
+		}
+	})
+
+	t.Run("should log names of cookies set by response", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:            lecho.New(b),
+			LogSetCookieNames: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			c.SetCookie(&http.Cookie{Name: "session", Value: "secret-session", HttpOnly: true})
+			c.SetCookie(&http.Cookie{Name: "theme", Value: "dark", Path: "/"})
+
+			return c.NoContent(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		str := b.String()
+		assert.Contains(t, str, `"set_cookies":["session","theme"]`)
+		assert.NotContains(t, str, "secret-session")
+		assert.NotContains(t, str, "dark")
+		assert.NotContains(t, str, "HttpOnly")
+	})
+
+	t.Run("should log response content encoding", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:             lecho.New(b),
+			LogContentEncoding: true,
+		})
+
+		handler := m(middleware.Gzip()(func(c echo.Context) error {
+			return c.String(http.StatusOK, "foo")
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAcceptEncoding, "gzip")
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Contains(t, b.String(), `"content_encoding":"gzip"`)
+
+		b.Reset()
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.NotContains(t, b.String(), "content_encoding")
+	})
+
+	t.Run("should log number of inflight requests", func(t *testing.T) {
+		const n = 10
+
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:      lecho.New(zerolog.SyncWriter(b)),
+			LogInflight: true,
+		})
+
+		var started sync.WaitGroup
+		started.Add(n)
+
+		handler := m(func(c echo.Context) error {
+			started.Done()
+			started.Wait()
+
+			return nil
+		})
+
+		var done sync.WaitGroup
+
+		for i := 0; i < n; i++ {
+			done.Add(1)
+
+			go func() {
+				defer done.Done()
+
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				_ = handler(e.NewContext(req, httptest.NewRecorder()))
+			}()
+		}
+
+		done.Wait()
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+		max := int64(0)
+
+		if assert.Len(t, lines, n) {
+			for _, line := range lines {
+				var record struct {
+					Inflight int64 `json:"inflight"`
+				}
+
+				assert.NoError(t, json.Unmarshal([]byte(line), &record))
+				assert.True(t, record.Inflight >= 1 && record.Inflight <= n, line)
+
+				if record.Inflight > max {
+					max = record.Inflight
+				}
+			}
+		}
+
+		assert.Equal(t, int64(n), max)
+
+		b.Reset()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.Panics(t, func() {
+			_ = m(func(c echo.Context) error {
+				panic("foo")
+			})(e.NewContext(req, httptest.NewRecorder()))
+		})
+
+		started.Add(1)
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())))
+		assert.Contains(t, b.String(), `"inflight":1`, "should decrement on panics")
+	})
+
+	t.Run("should flag unmatched routes", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		e.Use(lecho.Middleware(lecho.Config{
+			Logger:              lecho.New(b),
+			FlagUnmatchedRoutes: true,
+		}))
+		e.GET("/users/:id", func(c echo.Context) error {
+			return c.NoContent(http.StatusNotFound)
+		})
+		e.GET("/users/:id/posts", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+		e.RouteNotFound("/static/*", func(c echo.Context) error {
+			return c.NoContent(http.StatusNotFound)
+		})
+
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/wp-admin", nil))
+
+		assert.Contains(t, b.String(), `{"level":"warn","error":"code=404, message=Not Found"`)
+		assert.Contains(t, b.String(), `"unmatched_route":true`)
+
+		b.Reset()
+
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1/x", nil))
+
+		assert.Contains(t, b.String(), `"unmatched_route":true`, "should flag nested unknown paths")
+
+		b.Reset()
+
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/static/app.js", nil))
+
+		assert.Contains(t, b.String(), `"unmatched_route":true`, "should flag paths handled by RouteNotFound")
+
+		b.Reset()
+
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+
+		assert.Contains(t, b.String(), `"status":404`)
+		assert.NotContains(t, b.String(), "unmatched_route", "should not flag matched routes")
+	})
+
+	t.Run("should log schema version", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:        lecho.New(b),
+			SchemaVersion: "v2",
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"log_schema":"v2","remote_ip"`)
+	})
+
+	t.Run("should log idempotency key hash", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:            lecho.New(b),
+			IdempotencyHeader: "Idempotency-Key",
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set("Idempotency-Key", "client-secret-key")
+			assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		}
+
+		// first 8 bytes of sha256("client-secret-key")
+		assert.Equal(t, 2, strings.Count(b.String(), `"idempotency_key_hash":"5c480d0454454b69"`), "should be stable")
+		assert.NotContains(t, b.String(), "client-secret-key")
+
+		b.Reset()
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.NotContains(t, b.String(), "idempotency_key_hash")
+	})
+
+	t.Run("should log tagged requests at trace level", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:           lecho.New(b, lecho.WithLevel(log.INFO)),
+			DebugTraceHeader: "X-Debug-Trace",
+			DebugTraceSecret: "s3cr3t",
+		})
+
+		var level log.Lvl
+		handler := m(func(c echo.Context) error {
+			level = c.Logger().Level()
+			zerolog.Ctx(c.Request().Context()).Trace().Msg("handler trace")
+
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Debug-Trace", "s3cr3t")
+		req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+		req.Header.Set("X-Api-Key", "key")
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+
+		str := b.String()
+		assert.Contains(t, str, `{"level":"trace","message":"handler trace"}`)
+		assert.Contains(t, str, `{"level":"trace","remote_ip"`)
+		assert.Contains(t, str, `"headers":{"Authorization":"[REDACTED]","X-Api-Key":"[REDACTED]","X-Debug-Trace":["s3cr3t"]}`)
+		assert.Contains(t, str, `"timing":{"setup":`)
+		assert.NotContains(t, str, "Bearer secret")
+		assert.Equal(t, log.DEBUG, level, "should report the level of the request logger")
+
+		for name, value := range map[string]string{
+			"untagged":     "",
+			"wrong secret": "1",
+		} {
+			t.Run(name, func(t *testing.T) {
+				b.Reset()
+
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("X-Debug-Trace", value)
+				assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+
+				str := b.String()
+				assert.Contains(t, str, `{"level":"info"`)
+				assert.NotContains(t, str, "handler trace")
+				assert.NotContains(t, str, `"headers"`)
+				assert.NotContains(t, str, `"timing"`)
+				assert.Equal(t, log.INFO, level)
+			})
+		}
+	})
+
+	t.Run("should ignore the debug trace header without a secret", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:           lecho.New(b, lecho.WithLevel(log.INFO)),
+			DebugTraceHeader: "X-Debug-Trace",
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Debug-Trace", "")
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Contains(t, b.String(), `{"level":"info"`)
+		assert.NotContains(t, b.String(), `"headers"`)
+	})
+
+	t.Run("should redact the configured headers", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:           lecho.New(b),
+			DebugTraceHeader: "X-Debug-Trace",
+			DebugTraceSecret: "s3cr3t",
+			RedactHeaders:    []string{"x-tenant"},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Debug-Trace", "s3cr3t")
+		req.Header.Set("X-Tenant", "acme")
+		req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.Contains(t, b.String(), `"headers":{"Authorization":["Bearer secret"],"X-Debug-Trace":["s3cr3t"],"X-Tenant":"[REDACTED]"}`)
+	})
+
+	t.Run("should log route group", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		e.Use(lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			GroupExtractor: lecho.DefaultGroupExtractor,
+		}))
+		e.Group("/api/v1").GET("/users/:id", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil))
+
+		assert.Contains(t, b.String(), `"group":"/api"`)
+	})
+
+	t.Run("should log wall clock latency", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			LogWallLatency: true,
+			Clock: func() time.Time {
+				now = now.Add(time.Second)
+
+				return now
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		// the clock is read at start, before and after the next handler
+		assert.Contains(t, b.String(), `"latency":2000,"latency_human":"2s","latency_wall":2000`)
+	})
+
+	t.Run("should log error categories", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger: lecho.New(b),
+			ErrorClassifier: func(err error, status int) string {
+				switch {
+				case errors.Is(err, context.DeadlineExceeded):
+					return "timeout"
+				case status == http.StatusUnauthorized:
+					return "auth"
+				default:
+					return ""
+				}
+			},
+		})
+
+		for _, tc := range []struct {
+			err      error
+			expected string
+		}{
+			{fmt.Errorf("query: %w", context.DeadlineExceeded), `"error_category":"timeout"`},
+			{echo.ErrUnauthorized, `"error_category":"auth"`},
+		} {
+			b.Reset()
+			handler := m(func(c echo.Context) error {
+				return tc.err
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			_ = handler(e.NewContext(req, httptest.NewRecorder()))
+
+			assert.Contains(t, b.String(), tc.expected)
+		}
+
+		b.Reset()
+		handler := m(func(c echo.Context) error {
+			return errors.New("error")
+		})
+		_ = handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+
+		assert.NotContains(t, b.String(), "error_category", "should omit empty categories")
+
+		b.Reset()
+		handler = m(func(c echo.Context) error {
+			return c.String(http.StatusUnauthorized, "unauthorized")
+		})
+		_ = handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+
+		assert.NotContains(t, b.String(), "error_category", "should not classify requests without errors")
+	})
+
+	t.Run("should log successful requests at debug level during warmup", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		now := time.Now()
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b, lecho.WithLevel(log.INFO)),
+			WarmupDuration: time.Minute,
+			Clock: func() time.Time {
+				return now
+			},
+		})
+
+		status := http.StatusOK
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(status)
+		})
+		serve := func() {
+			b.Reset()
+			_ = handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+		}
+
+		serve()
+		assert.Empty(t, b.String(), "should log at debug level within the warmup period")
+
+		status = http.StatusInternalServerError
+		serve()
+		assert.Contains(t, b.String(), `"status":500`, "should log failed requests within the warmup period")
+
+		now = now.Add(time.Minute)
+		status = http.StatusOK
+		serve()
+		assert.Contains(t, b.String(), `"level":"info"`, "should log at the regular level after the warmup period")
+	})
+
+	t.Run("should log wait time", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		now := time.Now()
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			EnqueueTimeKey: "enqueued_at",
+			Clock: func() time.Time {
+				return now
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		c.Set("enqueued_at", now.Add(-250*time.Millisecond))
+		_ = handler(c)
+
+		assert.Contains(t, b.String(), `"wait_time":250`)
+
+		b.Reset()
+		_ = handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+
+		assert.NotContains(t, b.String(), "wait_time", "should omit the wait time without an enqueue time")
+	})
+
+	t.Run("should log slow requests again at debug level", func(t *testing.T) {
+		for _, level := range []log.Lvl{log.DEBUG, log.INFO} {
+			e := echo.New()
+			b := &bytes.Buffer{}
+			m := lecho.Middleware(lecho.Config{
+				Logger:           lecho.New(b, lecho.WithLevel(level)),
+				SlowRequestDebug: 10 * time.Millisecond,
+			})
+
+			delay := 20 * time.Millisecond
+			handler := m(func(c echo.Context) error {
+				time.Sleep(delay)
+
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Authorization", "secret")
+			req.Header.Set("Accept", "text/plain")
+			_ = handler(e.NewContext(req, httptest.NewRecorder()))
+
+			lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+
+			if assert.Len(t, lines, 2, "should log the debug line at level %v", level) {
+				assert.NotContains(t, lines[0], `"headers"`)
+				assert.Contains(t, lines[1], `"level":"debug","method":"GET","uri":"/","status":200,"headers":{"Accept":["text/plain"],"Authorization":"[REDACTED]"},"timing":{`)
+				assert.Contains(t, lines[1], `"message":"slow request"`)
+			}
+
+			b.Reset()
+			delay = 0
+			_ = handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+
+			assert.Equal(t, 1, strings.Count(b.String(), "\n"), "should log fast requests once")
+		}
+	})
+
+	t.Run("should log the remaining time until the deadline", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		now := time.Now()
+		m := lecho.Middleware(lecho.Config{
+			Logger:      lecho.New(b),
+			LogDeadline: true,
+			Clock: func() time.Time {
+				return now
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+
+		for _, tc := range []struct {
+			deadline time.Time
+			expected string
+		}{
+			{now.Add(2 * time.Second), `"deadline_remaining":2000`},
+			{now.Add(-time.Second), `"deadline_remaining":-1000`},
+		} {
+			b.Reset()
+			ctx, cancel := context.WithDeadline(context.Background(), tc.deadline)
+			req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			_ = handler(e.NewContext(req, httptest.NewRecorder()))
+			cancel()
+
+			assert.Contains(t, b.String(), tc.expected)
+		}
+
+		b.Reset()
+		_ = handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+
+		assert.NotContains(t, b.String(), "deadline_remaining", "should omit the field without a deadline")
+	})
+
+	t.Run("should log HTTP/2 stream IDs", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			LogHTTP2Stream: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+
+		for _, tc := range []struct {
+			name     string
+			major    int
+			streamID bool
+			expected bool
+		}{
+			{"HTTP/2", 2, true, true},
+			{"HTTP/2 without stream ID", 2, false, false},
+			{"HTTP/1.1", 1, true, false},
+		} {
+			b.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.ProtoMajor = tc.major
+
+			if tc.streamID {
+				req = req.WithContext(lecho.WithHTTP2StreamID(req.Context(), 5))
+			}
+
+			_ = handler(e.NewContext(req, httptest.NewRecorder()))
+
+			if tc.expected {
+				assert.Contains(t, b.String(), `"http2_stream":5`, tc.name)
+			} else {
+				assert.NotContains(t, b.String(), "http2_stream", tc.name)
+			}
+		}
+	})
+
+	t.Run("should log normalized paths", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			PathNormalizer: lecho.DefaultPathNormalizer,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/users/123/files/3f2b8e6a-1c4d-4e5f-8a9b-0c1d2e3f4a5b?download=1", nil)
+		_ = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.Contains(t, b.String(), `"normalized_path":"/users/:id/files/:id"`)
+	})
+
+	t.Run("should log CORS origins", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:  lecho.New(b),
+			LogCORS: true,
+		})
+
+		for _, tc := range []struct {
+			origin   string
+			allow    string
+			expected string
+		}{
+			{"https://example.com", "https://example.com", `"origin":"https://example.com","cors_allowed":true`},
+			{"https://example.com", "*", `"origin":"https://example.com","cors_allowed":true`},
+			{"https://evil.com", "https://example.com", `"origin":"https://evil.com","cors_allowed":false`},
+			{"https://example.com", "", `"origin":"https://example.com","cors_allowed":false`},
+		} {
+			b.Reset()
+			handler := m(func(c echo.Context) error {
+				if tc.allow != "" {
+					c.Response().Header().Set(echo.HeaderAccessControlAllowOrigin, tc.allow)
+				}
+
+				return c.NoContent(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(echo.HeaderOrigin, tc.origin)
+			_ = handler(e.NewContext(req, httptest.NewRecorder()))
+
+			assert.Contains(t, b.String(), tc.expected)
+		}
+
+		b.Reset()
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+		_ = handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+
+		assert.NotContains(t, b.String(), "origin", "should omit the fields without an origin")
+		assert.NotContains(t, b.String(), "cors_allowed")
+	})
+
+	t.Run("should log sub-timings", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger: lecho.New(b),
+			SubTimings: map[string]string{
+				"db_time":    "db_duration",
+				"cache_time": "cache_duration",
+				"api_time":   "api_duration",
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			c.Set("db_duration", 120*time.Millisecond)
+			c.Set("cache_duration", 3*time.Millisecond)
+
+			return c.NoContent(http.StatusOK)
+		})
+		_ = handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+
+		assert.Contains(t, b.String(), `"cache_time":3,"db_time":120`)
+		assert.NotContains(t, b.String(), "api_time", "should omit absent sub-timings")
+	})
+
+	t.Run("should log client certificates", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:        lecho.New(b),
+			LogClientCert: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{
+				{Subject: pkix.Name{CommonName: "billing-service"}, SerialNumber: big.NewInt(4096)},
+				{Subject: pkix.Name{CommonName: "internal-ca"}, SerialNumber: big.NewInt(1)},
+			},
+		}
+		_ = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.Contains(t, b.String(), `"client_cert_subject":"billing-service","client_cert_serial":"4096"`)
+
+		b.Reset()
+		req = httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+		_ = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NotContains(t, b.String(), "client_cert", "should omit the fields without a client certificate")
+	})
+
+	t.Run("should write request logs through the buffer of the logger", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithBufferedWriter(4096))
+		m := lecho.Middleware(lecho.Config{
+			Logger: l,
+		})
+
+		handler := m(func(c echo.Context) error {
+			c.Logger().Info("handling")
+
+			return c.NoContent(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderXRequestID, "123")
+		_ = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.Empty(t, b.String(), "should buffer the records")
+		assert.NoError(t, l.Flush())
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+
+		if assert.Len(t, lines, 2) {
+			assert.Equal(t, `{"level":"info","id":"123","message":"handling"}`, lines[0])
+			assert.Contains(t, lines[1], `"uri":"/"`)
+		}
+	})
+
+	t.Run("should count failed writes of request logs", func(t *testing.T) {
+		e := echo.New()
+		fallback := &bytes.Buffer{}
+		l := lecho.New(os.Stdout, lecho.WithFallback(failingWriter{}, fallback))
+		m := lecho.Middleware(lecho.Config{
+			Logger: l,
+		})
+
+		handler := m(func(c echo.Context) error {
+			c.Logger().Info("handling")
+
+			return c.NoContent(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderXRequestID, "123")
+		_ = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.Equal(t, uint64(2), l.WriteErrors())
+		assert.Contains(t, fallback.String(), `"message":"handling"`)
+	})
+
+	t.Run("should read the time to first byte from the clock", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		m := lecho.Middleware(lecho.Config{
+			Logger:  lecho.New(b),
+			LogTTFB: true,
+			Clock: func() time.Time {
+				now = now.Add(time.Second)
+
+				return now
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return c.String(http.StatusOK, "foo")
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		// the clock is read at start, before the next handler and on the first write
+		assert.Contains(t, b.String(), `"ttfb":2000`)
+	})
+
+	t.Run("should discard request logs once the logger is closed", func(t *testing.T) {
+		e := echo.New()
+		b := &closingBuffer{}
+		l := lecho.New(b)
+		m := lecho.Middleware(lecho.Config{
+			Logger: l,
+		})
+
+		started := make(chan struct{})
+		closed := make(chan struct{})
+		handler := m(func(c echo.Context) error {
+			close(started)
+
+			for {
+				select {
+				case <-closed:
+					return nil
+				default:
+					c.Logger().Info("handling")
+				}
+			}
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		errs := make(chan error, 1)
+
+		go func() {
+			errs <- handler(e.NewContext(req, httptest.NewRecorder()))
+		}()
+
+		<-started
+		assert.NoError(t, l.Close())
+		close(closed)
+		assert.NoError(t, <-errs, "should not return error")
+		assert.NotContains(t, b.String(), `"status"`, "should discard the access log written after closing")
+		assert.Zero(t, b.rejected, "should not write to the closed output")
+	})
+
+	t.Run("should keep the optional interfaces of the response writer when logging ttfb", func(t *testing.T) {
+		e := echo.New()
+		m := lecho.Middleware(lecho.Config{
+			Logger:  lecho.New(io.Discard),
+			LogTTFB: true,
+		})
+
+		var flusher, hijacker bool
+		handler := m(func(c echo.Context) error {
+			_, flusher = c.Response().Writer.(http.Flusher)
+			_, hijacker = c.Response().Writer.(http.Hijacker)
+
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())), "should not return error")
+		assert.True(t, flusher)
+		assert.False(t, hijacker, "should not implement http.Hijacker if the wrapped writer does not")
+
+		rw := struct{ http.ResponseWriter }{httptest.NewRecorder()}
+		assert.NoError(t, handler(e.NewContext(req, rw)), "should not return error")
+		assert.False(t, flusher, "should not implement http.Flusher if the wrapped writer does not")
+		assert.False(t, hijacker)
+	})
+
 	t.Run("should escalate log level for slow requests", func(t *testing.T) {
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		b := &bytes.Buffer{}
+		l := lecho.New(b)
+		l.SetLevel(log.INFO)
+		m := lecho.Middleware(lecho.Config{
+			Logger:              l,
+			RequestLatencyLimit: 5 * time.Millisecond,
+			RequestLatencyLevel: zerolog.WarnLevel,
+		})
+
+		// Slow request should be logged at the escalated level
+		next := func(c echo.Context) error {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		}
+		handler := m(next)
+		err := handler(c)
+		assert.NoError(t, err, "should not return error")
+
+		str := b.String()
+		assert.Contains(t, str, `"level":"warn"`)
+		assert.NotContains(t, str, `"level":"info"`)
+	})
+
+	t.Run("shouldn't escalate log level for fast requests", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		b := &bytes.Buffer{}
+		l := lecho.New(b)
+		l.SetLevel(log.INFO)
+		m := lecho.Middleware(lecho.Config{
+			Logger:              l,
+			RequestLatencyLimit: 5 * time.Millisecond,
+			RequestLatencyLevel: zerolog.WarnLevel,
+		})
+
+		// Fast request should be logged at the default level
+		next := func(c echo.Context) error {
+			time.Sleep(1 * time.Millisecond)
+			return nil
+		}
+
+		handler := m(next)
+		err := handler(c)
+
+		assert.NoError(t, err, "should not return error")
+
+		str := b.String()
+		assert.Contains(t, str, `"level":"info"`)
+		assert.NotContains(t, str, `"level":"warn"`)
+	})
+
+	t.Run("should log runtime stats only for slow requests", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		l := lecho.New(b)
+		l.SetLevel(log.INFO)
+		m := lecho.Middleware(lecho.Config{
+			Logger:                l,
+			RequestLatencyLimit:   5 * time.Millisecond,
+			RequestLatencyLevel:   zerolog.WarnLevel,
+			LogRuntimeStatsOnSlow: true,
+		})
+
+		fast := m(func(c echo.Context) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := fast(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		str := b.String()
+		assert.NotContains(t, str, `"goroutines"`)
+		assert.NotContains(t, str, `"heap_inuse"`)
+
+		b.Reset()
+
+		slow := m(func(c echo.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		err = slow(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		str = b.String()
+		assert.Contains(t, str, `"goroutines":`)
+		assert.Contains(t, str, `"heap_inuse":`)
+	})
+
+	t.Run("should round latency_human to LatencyHumanPrecision", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:                lecho.New(b),
+			LatencyHumanPrecision: time.Millisecond,
+		})
+
+		next := func(c echo.Context) error {
+			time.Sleep(2 * time.Millisecond)
+			return nil
+		}
+
+		handler := m(next)
+		err := handler(c)
+
+		assert.NoError(t, err, "should not return error")
+
+		entry := struct {
+			LatencyHuman string `json:"latency_human"`
+		}{}
+		assert.NoError(t, json.Unmarshal(b.Bytes(), &entry))
+
+		latency, err := time.ParseDuration(entry.LatencyHuman)
+		assert.NoError(t, err)
+		assert.Equal(t, time.Duration(0), latency%time.Millisecond, "should be rounded to milliseconds")
+	})
+
+	t.Run("should log user from UserExtractor", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger: lecho.New(b),
+			UserExtractor: func(c echo.Context) (string, bool) {
+				user, ok := c.Get("user").(string)
+
+				return user, ok
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			c.Set("user", "john")
+
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"user":"john"`)
+
+		b.Reset()
+
+		handler = m(func(c echo.Context) error {
+			return nil
+		})
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		err = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.NotContains(t, b.String(), `"user"`)
+	})
+
+	t.Run("should compact multi-line errors", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger: lecho.New(b, lecho.WithCompactErrors()),
+		})
+
+		handler := m(func(c echo.Context) error {
+			return errors.New("validation failed:\n\tname is required")
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderXRequestID, "123")
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.Error(t, err, "should return error")
+		assert.Equal(t, 1, strings.Count(b.String(), "\n"), "should be a single line")
+		assert.Contains(t, b.String(), `"error":"validation failed:  name is required"`)
+	})
+
+	t.Run("should log ttfb", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:  lecho.New(b),
+			LogTTFB: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			time.Sleep(5 * time.Millisecond)
+
+			if err := c.String(http.StatusOK, "foo"); err != nil {
+				return err
+			}
+
+			time.Sleep(5 * time.Millisecond)
+
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+
+		entry := struct {
+			TTFB    *float64 `json:"ttfb"`
+			Latency float64  `json:"latency"`
+		}{}
+		assert.NoError(t, json.Unmarshal(b.Bytes(), &entry))
+
+		if assert.NotNil(t, entry.TTFB) {
+			assert.GreaterOrEqual(t, *entry.TTFB, float64(5))
+			assert.Less(t, *entry.TTFB, entry.Latency)
+		}
+	})
+
+	t.Run("should omit ttfb when nothing was written", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:  lecho.New(b),
+			LogTTFB: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.NotContains(t, b.String(), `"ttfb"`)
+	})
+
+	t.Run("should use error marshal func", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger: lecho.New(b, lecho.WithErrorMarshalFunc(func(err error) interface{} {
+				return map[string]string{"message": err.Error()}
+			})),
+		})
+
+		handler := m(func(c echo.Context) error {
+			return errors.New("error")
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.Error(t, err, "should return error")
+		assert.Contains(t, b.String(), `"error":{"message":"error"}`)
+	})
+
+	t.Run("should log request body only for configured content types", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:              lecho.New(b),
+			LogBodyContentTypes: []string{echo.MIMEApplicationJSON},
+			LogBodyLimit:        7,
+		})
+
+		var read string
+		handler := m(func(c echo.Context) error {
+			data, err := io.ReadAll(c.Request().Body)
+			read = string(data)
+
+			return err
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"foo":"bar"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSONCharsetUTF8)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Equal(t, `{"foo":"bar"}`, read, "should restore body")
+		assert.Contains(t, b.String(), `"body":"{\"foo\":"`)
+
+		b.Reset()
+
+		req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("--boundary--"))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEMultipartForm+"; boundary=boundary")
+		err = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Equal(t, "--boundary--", read, "should not touch body")
+		assert.NotContains(t, b.String(), `"body"`)
+	})
+
+	t.Run("should log ISO8601 latency", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			LatencyISO8601: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Regexp(t, `"latency_iso":"PT0\.\d+S"`, b.String())
+	})
+
+	t.Run("should sample requests with SampleFunc", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		rnd := []float64{0.1, 0.6, 0.4, 0.9}
+		m := lecho.Middleware(lecho.Config{
+			Logger: lecho.New(b),
+			SampleFunc: func(c echo.Context) float64 {
+				switch c.Request().Header.Get("X-Tenant") {
+				case "premium":
+					return 1
+				case "blocked":
+					return 0
+				default:
+					return 0.5
+				}
+			},
+			SampleRand: func() float64 {
+				r := rnd[0]
+				rnd = rnd[1:]
+
+				return r
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		for _, tenant := range []string{"premium", "blocked", "free", "free", "free", "free"} {
+			req := httptest.NewRequest(http.MethodGet, "/"+tenant, nil)
+			req.Header.Set("X-Tenant", tenant)
+			err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+			assert.NoError(t, err, "should not return error")
+		}
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+
+		assert.Len(t, lines, 3)
+		assert.Contains(t, lines[0], `"uri":"/premium"`)
+		assert.Contains(t, lines[1], `"uri":"/free"`)
+		assert.Contains(t, lines[2], `"uri":"/free"`)
+		assert.Empty(t, rnd, "should consult the RNG only for partial probabilities")
+
+		b.Reset()
+
+		for _, next := range []echo.HandlerFunc{
+			func(c echo.Context) error {
+				return errors.New("error")
+			},
+			func(c echo.Context) error {
+				return c.NoContent(http.StatusServiceUnavailable)
+			},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/blocked", nil)
+			req.Header.Set("X-Tenant", "blocked")
+			_ = m(next)(e.NewContext(req, httptest.NewRecorder()))
+		}
+
+		lines = strings.Split(strings.TrimSpace(b.String()), "\n")
+
+		if assert.Len(t, lines, 2, "should always log failed requests") {
+			assert.Contains(t, lines[0], `"error":"error"`)
+			assert.Contains(t, lines[1], `"status":503`)
+		}
+	})
+
+	t.Run("should detect bots", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:     lecho.New(b),
+			DetectBots: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"is_bot":true,"bot_name":"googlebot"`)
+
+		b.Reset()
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0")
+		err = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"is_bot":false`)
+		assert.NotContains(t, b.String(), `"bot_name"`)
+	})
+
+	t.Run("should omit is_bot for non-bots when OmitNonBots is true", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:      lecho.New(b),
+			DetectBots:  true,
+			OmitNonBots: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/120.0")
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.NotContains(t, b.String(), `"is_bot"`)
+	})
+
+	t.Run("should log request fingerprint", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:             lecho.New(b),
+			FingerprintHeaders: []string{"X-Client"},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		fingerprint := func(method, path, client string) string {
+			b.Reset()
+
+			req := httptest.NewRequest(method, path, nil)
+			req.Header.Set("X-Client", client)
+			req.Header.Set("X-Other", time.Now().String())
+			err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+			assert.NoError(t, err, "should not return error")
+
+			entry := struct {
+				Fingerprint string `json:"request_fingerprint"`
+			}{}
+			assert.NoError(t, json.Unmarshal(b.Bytes(), &entry))
+			assert.NotEmpty(t, entry.Fingerprint)
+
+			return entry.Fingerprint
+		}
+
+		first := fingerprint(http.MethodPost, "/orders", "foo")
 
+		assert.Equal(t, first, fingerprint(http.MethodPost, "/orders", "foo"))
+		assert.NotEqual(t, first, fingerprint(http.MethodPost, "/orders", "bar"))
+		assert.NotEqual(t, first, fingerprint(http.MethodGet, "/orders", "foo"))
+	})
+
+	t.Run("should log errors separately when SeparateErrorLog is true", func(t *testing.T) {
+		e := echo.New()
 		b := &bytes.Buffer{}
 		l := lecho.New(b)
 		l.SetLevel(log.INFO)
 		m := lecho.Middleware(lecho.Config{
-			Logger:              l,
-			RequestLatencyLimit: 5 * time.Millisecond,
-			RequestLatencyLevel: zerolog.WarnLevel,
+			Logger:           l,
+			SeparateErrorLog: true,
 		})
 
-		// Slow request should be logged at the escalated level
-		next := func(c echo.Context) error {
-			time.Sleep(5 * time.Millisecond)
-			return nil
+		handler := m(func(c echo.Context) error {
+			return errors.New("error")
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderXRequestID, "123")
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.Error(t, err, "should return error")
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+
+		if assert.Len(t, lines, 2) {
+			assert.Contains(t, lines[0], `"level":"info","id":"123"`)
+			assert.Contains(t, lines[0], `"uri":"/"`)
+			assert.NotContains(t, lines[0], `"error"`)
+			assert.True(t, strings.HasPrefix(lines[1], `{"level":"error","id":"123","error":"error"`), lines[1])
+			assert.NotContains(t, lines[1], `"stack"`, "should not add a stack without zerolog.ErrorStackMarshaler")
 		}
-		handler := m(next)
-		err := handler(c)
+	})
+
+	t.Run("should log the stack of the error on the separate error line", func(t *testing.T) {
+		defer func(marshaler func(err error) interface{}) {
+			zerolog.ErrorStackMarshaler = marshaler
+		}(zerolog.ErrorStackMarshaler)
+
+		zerolog.ErrorStackMarshaler = marshalStack
+
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:           lecho.New(b),
+			SeparateErrorLog: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return newStackError()
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.Error(t, err, "should return error")
+
+		lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+
+		if assert.Len(t, lines, 2) {
+			assert.True(t, strings.HasPrefix(lines[1], `{"level":"error","stack":[{"func":"github.com/ziflex/lecho/v3_test.newStackError"}`), lines[1])
+		}
+	})
+
+	t.Run("should log cache hits", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:      lecho.New(b),
+			CacheHeader: "X-Cache",
+		})
+
+		handler := m(func(c echo.Context) error {
+			if c.QueryParam("cached") == "true" {
+				c.Response().Header().Set("X-Cache", "HIT")
+			}
+
+			return c.NoContent(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/?cached=true", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
 		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"cache_hit":true`)
 
-		str := b.String()
-		assert.Contains(t, str, `"level":"warn"`)
-		assert.NotContains(t, str, `"level":"info"`)
+		b.Reset()
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		err = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"cache_hit":false`)
 	})
 
-	t.Run("shouldn't escalate log level for fast requests", func(t *testing.T) {
+	t.Run("should not log cache hits when CacheHeader is empty", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger: lecho.New(b),
+		})
+
+		handler := m(func(c echo.Context) error {
+			c.Response().Header().Set("X-Cache", "HIT")
+
+			return c.NoContent(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.NotContains(t, b.String(), `"cache_hit"`)
+	})
+
+	t.Run("should log multipart uploads metadata", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		mw := multipart.NewWriter(body)
+
+		assert.NoError(t, mw.WriteField("name", "foo"))
+
+		fw, err := mw.CreateFormFile("avatar", "me.png")
+		assert.NoError(t, err)
+		_, err = fw.Write([]byte("12345"))
+		assert.NoError(t, err)
+
+		fw, err = mw.CreateFormFile("docs", "cv.pdf")
+		assert.NoError(t, err)
+		_, err = fw.Write([]byte("123"))
+		assert.NoError(t, err)
+
+		assert.NoError(t, mw.Close())
+
+		for name, handler := range map[string]echo.HandlerFunc{
+			"consumed by handler": func(c echo.Context) error {
+				fh, err := c.FormFile("avatar")
+
+				if err != nil {
+					return err
+				}
+
+				assert.Equal(t, "me.png", fh.Filename)
+				assert.Equal(t, "foo", c.FormValue("name"))
+
+				return nil
+			},
+			"ignored by handler": func(c echo.Context) error {
+				return nil
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				e := echo.New()
+				b := &bytes.Buffer{}
+				m := lecho.Middleware(lecho.Config{
+					Logger:           lecho.New(b),
+					LogMultipartMeta: true,
+				})
+
+				req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body.Bytes()))
+				req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+				err := m(handler)(e.NewContext(req, httptest.NewRecorder()))
+
+				assert.NoError(t, err, "should not return error")
+				assert.Contains(t, b.String(), `"uploads":[{"field":"avatar","filename":"me.png","size":5},{"field":"docs","filename":"cv.pdf","size":3}]`)
+				assert.NotContains(t, b.String(), "12345")
+			})
+		}
+
+		t.Run("should remove the temporary files of the parsed form", func(t *testing.T) {
+			e := echo.New()
+			m := lecho.Middleware(lecho.Config{
+				Logger:           lecho.New(io.Discard),
+				LogMultipartMeta: true,
+				MultipartMemory:  1,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body.Bytes()))
+			req.Header.Set(echo.HeaderContentType, mw.FormDataContentType())
+			c := e.NewContext(req, httptest.NewRecorder())
+			err := m(func(c echo.Context) error {
+				return nil
+			})(c)
+
+			assert.NoError(t, err, "should not return error")
+
+			// the middleware replaces the request of the context
+			if form := c.Request().MultipartForm; assert.NotNil(t, form) {
+				_, err = form.File["avatar"][0].Open()
+
+				assert.Error(t, err, "should not keep the file on disk")
+			}
+		})
+	})
+
+	t.Run("should log header stats", func(t *testing.T) {
 		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			LogHeaderStats: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
-		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
+		req.Header = http.Header{}
+		req.Header.Set("Accept", "*/*")
+		req.Header.Add("X-Foo", "secret-1")
+		req.Header.Add("X-Foo", "secret-2")
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
 
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"header_count":3,"header_bytes":47`)
+		assert.NotContains(t, b.String(), "secret")
+	})
+
+	t.Run("should log instance id", func(t *testing.T) {
+		e := echo.New()
 		b := &bytes.Buffer{}
-		l := lecho.New(b)
-		l.SetLevel(log.INFO)
 		m := lecho.Middleware(lecho.Config{
-			Logger:              l,
-			RequestLatencyLimit: 5 * time.Millisecond,
-			RequestLatencyLevel: zerolog.WarnLevel,
+			Logger:     lecho.New(b),
+			InstanceID: "node-1",
 		})
 
-		// Fast request should be logged at the default level
-		next := func(c echo.Context) error {
-			time.Sleep(1 * time.Millisecond)
+		handler := m(func(c echo.Context) error {
 			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"instance":"node-1"`)
+	})
+
+	t.Run("should log hostname as instance id when AutoInstanceID is true", func(t *testing.T) {
+		hostname, err := os.Hostname()
+
+		if err != nil {
+			t.Skip("hostname is unavailable")
 		}
 
-		handler := m(next)
-		err := handler(c)
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:         lecho.New(b),
+			AutoInstanceID: true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err = handler(e.NewContext(req, httptest.NewRecorder()))
 
 		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"instance":"`+hostname+`"`)
+	})
 
-		str := b.String()
-		assert.Contains(t, str, `"level":"info"`)
-		assert.NotContains(t, str, `"level":"warn"`)
+	t.Run("should log grpc status", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:           lecho.New(b),
+			GRPCStatusHeader: "Grpc-Status",
+		})
+
+		handler := m(func(c echo.Context) error {
+			if c.QueryParam("grpc") == "true" {
+				c.Response().Header().Set("Grpc-Status", "5")
+
+				return c.NoContent(http.StatusNotFound)
+			}
+
+			return c.NoContent(http.StatusOK)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/?grpc=true", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"status":404,"grpc_status":5`)
+
+		b.Reset()
+
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		err = handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.NotContains(t, b.String(), `"grpc_status"`)
+	})
+
+	t.Run("should log context values", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:            lecho.New(b),
+			ContextKeys:       []string{"tenant", "roles", "empty", "missing", "long"},
+			ContextValueLimit: 10,
+		})
+
+		handler := m(func(c echo.Context) error {
+			c.Set("tenant", "acme")
+			c.Set("roles", []string{"admin"})
+			c.Set("empty", nil)
+			c.Set("long", strings.Repeat("x", 20))
+
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"context_values":{"tenant":"acme","roles":["admin"],"long":"xxxxxxxxxx..."}`)
 	})
 
 	t.Run("should skip middleware before calling next handler when Skipper func returns true", func(t *testing.T) {
@@ -193,6 +2189,36 @@ func TestMiddleware(t *testing.T) {
 		assert.Empty(t, str, "should not log anything")
 	})
 
+	t.Run("should skip middleware for SkipPaths", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Middleware(lecho.Config{
+			Logger:    lecho.New(b),
+			SkipPaths: []string{"/health"},
+			Skipper: func(c echo.Context) bool {
+				return c.Request().URL.Path == "/skip"
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			return nil
+		})
+
+		for _, path := range []string{"/health", "/skip"} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+			assert.NoError(t, err, "should not return error")
+			assert.Empty(t, b.String(), "should not log anything")
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.Contains(t, b.String(), `"uri":"/users"`)
+	})
+
 	t.Run("should skip middleware after calling next handler when AfterNextSkipper func returns true", func(t *testing.T) {
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -223,3 +2249,30 @@ func TestMiddleware(t *testing.T) {
 		assert.Empty(t, str, "should not log anything")
 	})
 }
+
+func BenchmarkMiddleware(b *testing.B) {
+	e := echo.New()
+	m := lecho.Middleware(lecho.Config{
+		Logger: lecho.New(io.Discard),
+	})
+	handler := m(func(c echo.Context) error {
+		return nil
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXRequestID, "123")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		c.Reset(req, rec)
+		_ = handler(c)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("broken")
+}
@@ -0,0 +1,141 @@
+package lecho
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// DefaultObserverSize is the number of entries kept by WithObserver.
+const DefaultObserverSize = 100
+
+// Entry is a record captured by an observer.
+type Entry struct {
+	Level   zerolog.Level
+	Message string
+	// Fields holds the fields of the record other than the level and the message.
+	// It is nil if the record is not a JSON object, in which case Message holds the whole record.
+	Fields map[string]interface{}
+}
+
+// observer keeps the most recent records in a ring buffer.
+type observer struct {
+	mu      sync.Mutex
+	records []observedRecord
+	next    int
+	full    bool
+}
+
+type observedRecord struct {
+	level zerolog.Level
+	data  []byte
+}
+
+// observerWriter passes records to the underlying writer and captures them.
+type observerWriter struct {
+	out      io.Writer
+	observer *observer
+}
+
+// WithObserver captures the most recent DefaultObserverSize records.
+// The returned function returns a snapshot of them, oldest first.
+// Writer options take effect only when the output is known, i.e. with New or after SetOutput.
+func WithObserver() (Setter, func() []Entry) {
+	return WithObserverSize(DefaultObserverSize)
+}
+
+// WithObserverSize captures the most recent size records.
+// The returned function returns a snapshot of them, oldest first.
+func WithObserverSize(size int) (Setter, func() []Entry) {
+	if size <= 0 {
+		size = DefaultObserverSize
+	}
+
+	o := &observer{
+		records: make([]observedRecord, size),
+	}
+
+	setter := func(opts *Options) {
+		opts.writers = append(opts.writers, func(out io.Writer) io.Writer {
+			return &observerWriter{
+				out:      out,
+				observer: o,
+			}
+		})
+	}
+
+	return setter, o.entries
+}
+
+func (w *observerWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *observerWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	w.observer.add(level, p)
+
+	return writeLevel(w.out, level, p)
+}
+
+func (w *observerWriter) Flush() error {
+	return flushWriter(w.out)
+}
+
+func (o *observer) add(level zerolog.Level, p []byte) {
+	// p is reused by zerolog after the write
+	data := make([]byte, len(p))
+	copy(data, p)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.records[o.next] = observedRecord{level: level, data: data}
+	o.next = (o.next + 1) % len(o.records)
+
+	if o.next == 0 {
+		o.full = true
+	}
+}
+
+func (o *observer) entries() []Entry {
+	o.mu.Lock()
+	records := make([]observedRecord, 0, len(o.records))
+
+	if o.full {
+		records = append(records, o.records[o.next:]...)
+	}
+
+	records = append(records, o.records[:o.next]...)
+	o.mu.Unlock()
+
+	entries := make([]Entry, len(records))
+
+	for i, r := range records {
+		entries[i] = newEntry(r)
+	}
+
+	return entries
+}
+
+func newEntry(r observedRecord) Entry {
+	entry := Entry{Level: r.level}
+
+	if err := json.Unmarshal(r.data, &entry.Fields); err != nil {
+		entry.Fields = nil
+		entry.Message = strings.TrimSuffix(string(r.data), "\n")
+
+		return entry
+	}
+
+	if msg, ok := entry.Fields[zerolog.MessageFieldName].(string); ok {
+		entry.Message = msg
+	}
+
+	delete(entry.Fields, zerolog.MessageFieldName)
+	delete(entry.Fields, zerolog.LevelFieldName)
+
+	return entry
+}
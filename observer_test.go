@@ -0,0 +1,49 @@
+package lecho_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestWithObserver(t *testing.T) {
+	b := &bytes.Buffer{}
+	observe, entries := lecho.WithObserver()
+	l := lecho.New(b, observe, lecho.WithField("foo", "bar"))
+
+	l.Info("first")
+	l.Named("child").Warn("second")
+
+	assert.Equal(t, []lecho.Entry{
+		{Level: zerolog.InfoLevel, Message: "first", Fields: map[string]interface{}{"foo": "bar"}},
+		{Level: zerolog.WarnLevel, Message: "second", Fields: map[string]interface{}{"foo": "bar", "logger": "child"}},
+	}, entries())
+	assert.Contains(t, b.String(), `"message":"first"`, "should write to the output")
+}
+
+func TestWithObserverSize(t *testing.T) {
+	observe, entries := lecho.WithObserverSize(2)
+	l := lecho.New(&bytes.Buffer{}, observe)
+
+	assert.Empty(t, entries())
+
+	for _, msg := range []string{"foo", "bar", "baz"} {
+		l.Info(msg)
+	}
+
+	snapshot := entries()
+
+	if assert.Len(t, snapshot, 2) {
+		assert.Equal(t, "bar", snapshot[0].Message)
+		assert.Equal(t, "baz", snapshot[1].Message)
+	}
+
+	l.Info("qux")
+
+	assert.Equal(t, "baz", snapshot[1].Message, "should return a snapshot")
+	assert.Equal(t, "qux", entries()[1].Message)
+}
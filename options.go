@@ -1,15 +1,44 @@
 package lecho
 
 import (
+	"bufio"
+	"io"
+	"sync"
+	"time"
+
 	"github.com/labstack/gommon/log"
 	"github.com/rs/zerolog"
 )
 
 type (
 	Options struct {
+		base    zerolog.Logger
 		context zerolog.Context
 		level   log.Lvl
 		prefix  string
+		name    string
+		caller  func(c zerolog.Context) zerolog.Context
+		writers []func(w io.Writer) io.Writer
+		fields  map[string]interface{}
+
+		fieldPrefix string
+
+		compactErrors bool
+		errorMarshal  func(err error) interface{}
+		errorField    bool
+		stack         bool
+		stackSkip     int
+
+		startupParsing bool
+		rawJSONFields  map[string]struct{}
+		fallback       *fallbackWriter
+
+		// untimed skips the timestamps of WithTimestamp and WithTimeFunc, for Logger.LogAt
+		untimed bool
+
+		// index is the position of the setter being applied, slots the positions, plus one, of the setters owning a slot
+		index int
+		slots [slotCount]int
 	}
 
 	Setter func(opts *Options)
@@ -19,17 +48,58 @@ func newOptions(log zerolog.Logger, setters []Setter) *Options {
 	elvl, _ := MatchZeroLevel(log.GetLevel())
 
 	opts := &Options{
+		base:    log,
 		context: log.With(),
 		level:   elvl,
 	}
 
-	for _, set := range setters {
+	for i, set := range setters {
+		opts.index = i
 		set(opts)
 	}
 
+	if opts.caller != nil {
+		opts.context = opts.caller(opts.context)
+	}
+
 	return opts
 }
 
+// addFields records the given fields, so they can be retrieved by Logger.Fields.
+func (opts *Options) addFields(fields map[string]interface{}) {
+	opts.fields = mergeFields(opts.fields, fields)
+}
+
+// prefixFields returns the fields with the prefix prepended to their names.
+func prefixFields(prefix string, fields map[string]interface{}) map[string]interface{} {
+	if prefix == "" {
+		return fields
+	}
+
+	prefixed := make(map[string]interface{}, len(fields))
+
+	for k, v := range fields {
+		prefixed[prefix+k] = v
+	}
+
+	return prefixed
+}
+
+// mergeFields returns a new map with the fields of dst overridden by the fields of src.
+func mergeFields(dst, src map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(dst)+len(src))
+
+	for k, v := range dst {
+		merged[k] = v
+	}
+
+	for k, v := range src {
+		merged[k] = v
+	}
+
+	return merged
+}
+
 func WithLevel(level log.Lvl) Setter {
 	return func(opts *Options) {
 		zlvl, elvl := MatchEchoLevel(level)
@@ -39,39 +109,135 @@ func WithLevel(level log.Lvl) Setter {
 	}
 }
 
+// withZeroLevel sets the zerolog level, e.g. trace, which WithLevel cannot.
+func withZeroLevel(level zerolog.Level) Setter {
+	return func(opts *Options) {
+		elvl, zlvl := MatchZeroLevel(level)
+
+		opts.context = opts.context.Logger().Level(zlvl).With()
+		opts.level = elvl
+	}
+}
+
+// WithLevelStringOrDefault sets the level parsed from the given name, or def if the name is unknown.
+// The fallback is reported once with a warning.
+func WithLevelStringOrDefault(name string, def log.Lvl) Setter {
+	if level, err := ParseLevel(name); err == nil {
+		return WithLevel(level)
+	}
+
+	var once sync.Once
+
+	return func(opts *Options) {
+		once.Do(func() {
+			logger := opts.context.Logger()
+			logger.Warn().Msgf("unknown level %q, using the default level", name)
+		})
+
+		WithLevel(def)(opts)
+	}
+}
+
 func WithField(name string, value interface{}) Setter {
+	return func(opts *Options) {
+		withField(opts.fieldPrefix+name, value)(opts)
+	}
+}
+
+// withField adds the field without the prefix set by WithFieldPrefix.
+func withField(name string, value interface{}) Setter {
 	return func(opts *Options) {
 		opts.context = opts.context.Interface(name, value)
+		opts.addFields(map[string]interface{}{name: value})
 	}
 }
 
 func WithFields(fields map[string]interface{}) Setter {
 	return func(opts *Options) {
+		fields := prefixFields(opts.fieldPrefix, fields)
+
 		opts.context = opts.context.Fields(fields)
+		opts.addFields(fields)
 	}
 }
 
+// SchemaVersionFieldName is the field name used by WithSchemaVersion and Config.SchemaVersion.
+const SchemaVersionFieldName = "log_schema"
+
+// WithSchemaVersion tags every record with the version of the log format, so consumers can branch on it.
+// The field is not prefixed by WithFieldPrefix.
+func WithSchemaVersion(version string) Setter {
+	return withField(SchemaVersionFieldName, version)
+}
+
+// WithFieldPrefix prefixes the names of the fields added by WithField, WithFields and Logger.AddFields after it.
+// Fields added by zerolog, such as level, time and message, and by the middleware are not prefixed.
+func WithFieldPrefix(prefix string) Setter {
+	return func(opts *Options) {
+		opts.fieldPrefix = prefix
+	}
+}
+
+// WithTimestamp adds the current time to each record, like zerolog.Context.Timestamp,
+// except for records logged with Logger.LogAt.
 func WithTimestamp() Setter {
 	return func(opts *Options) {
-		opts.context = opts.context.Timestamp()
+		if !opts.untimed {
+			opts.context = opts.context.Timestamp()
+		}
+	}
+}
+
+// WithTimeFunc adds a timestamp produced by the provided function to each record,
+// except for records logged with Logger.LogAt.
+// Unlike zerolog.TimestampFunc, it affects only this logger.
+func WithTimeFunc(fn func() time.Time) Setter {
+	hook := WithHookFunc(func(e *zerolog.Event, level zerolog.Level, message string) {
+		e.Time(zerolog.TimestampFieldName, fn())
+	})
+
+	return func(opts *Options) {
+		if !opts.untimed {
+			hook(opts)
+		}
 	}
 }
 
 func WithCaller() Setter {
 	return func(opts *Options) {
-		opts.context = opts.context.Caller()
+		opts.caller = zerolog.Context.Caller
 	}
 }
 
 func WithCallerWithSkipFrameCount(skipFrameCount int) Setter {
 	return func(opts *Options) {
-		opts.context = opts.context.CallerWithSkipFrameCount(skipFrameCount)
+		opts.caller = func(c zerolog.Context) zerolog.Context {
+			return c.CallerWithSkipFrameCount(skipFrameCount)
+		}
 	}
 }
 
+// WithPrefix adds the prefix field. An empty prefix adds no field.
+// Logger.SetPrefix replaces the last WithPrefix, so the field keeps its position and can be removed.
 func WithPrefix(prefix string) Setter {
 	return func(opts *Options) {
-		opts.context = opts.context.Str("prefix", prefix)
+		opts.prefix = prefix
+		opts.slots[slotPrefix] = opts.index + 1
+
+		if prefix != "" {
+			opts.context = opts.context.Str("prefix", prefix)
+		}
+	}
+}
+
+func withName(name string) Setter {
+	return func(opts *Options) {
+		opts.name = name
+		opts.slots[slotName] = opts.index + 1
+
+		if name != "" {
+			opts.context = opts.context.Str("logger", name)
+		}
 	}
 }
 
@@ -86,3 +252,164 @@ func WithHookFunc(hook zerolog.HookFunc) Setter {
 		opts.context = opts.context.Logger().Hook(hook).With()
 	}
 }
+
+// WithCompactErrors replaces newlines and tabs in error messages with spaces.
+func WithCompactErrors() Setter {
+	return func(opts *Options) {
+		opts.compactErrors = true
+	}
+}
+
+// WithErrorMarshalFunc sets a function used to serialize errors into the error field.
+func WithErrorMarshalFunc(fn func(err error) interface{}) Setter {
+	return func(opts *Options) {
+		opts.errorMarshal = fn
+	}
+}
+
+// WithTee duplicates records with level greater than or equal to minLevel to the provided writer.
+// All records are still written to the primary output.
+// Writer options take effect only when the output is known, i.e. with New or after SetOutput.
+func WithTee(w io.Writer, minLevel zerolog.Level) Setter {
+	return func(opts *Options) {
+		opts.writers = append(opts.writers, func(out io.Writer) io.Writer {
+			return &teeWriter{
+				primary:   out,
+				secondary: w,
+				minLevel:  minLevel,
+			}
+		})
+	}
+}
+
+// WithWriter writes all records to w in addition to the output.
+// Writer options take effect only when the output is known, i.e. with New or after SetOutput.
+func WithWriter(w io.Writer) Setter {
+	return func(opts *Options) {
+		opts.writers = append(opts.writers, func(out io.Writer) io.Writer {
+			return multiWriter{out, w}
+		})
+	}
+}
+
+// WithLevelColors writes human-friendly colorized output using zerolog.ConsoleWriter
+// with the provided ANSI color codes per level. Unmapped levels use the default colors.
+func WithLevelColors(colors map[zerolog.Level]int) Setter {
+	return func(opts *Options) {
+		opts.writers = append(opts.writers, func(out io.Writer) io.Writer {
+			return newConsoleWriter(out, colors)
+		})
+	}
+}
+
+// WithBufferedWriter buffers the output with a buffer of the given size to reduce the number of writes.
+// Records are written only when the buffer is full or Logger.Flush is called,
+// so the logger must be flushed before the application exits, otherwise buffered records are lost.
+func WithBufferedWriter(size int) Setter {
+	return func(opts *Options) {
+		opts.writers = append(opts.writers, func(out io.Writer) io.Writer {
+			return &bufferedWriter{
+				buf: bufio.NewWriterSize(out, size),
+			}
+		})
+	}
+}
+
+// WithStack adds the stack of logged errors, like zerolog.Event.Stack.
+// zerolog.ErrorStackMarshaler must be set for this option to do something.
+func WithStack() Setter {
+	return func(opts *Options) {
+		opts.stack = true
+	}
+}
+
+// WithStackSkip drops the given number of leading frames from the stacks of errors added by WithStack,
+// when zerolog.ErrorStackMarshaler returns a slice of frames, so the stacks start at the user's code.
+// The stack logged by Logger.Stack starts at the first frame outside of lecho and zerolog, skipping skipFrameCount more frames.
+// It does not enable stacks.
+func WithStackSkip(skipFrameCount int) Setter {
+	return func(opts *Options) {
+		opts.stackSkip = skipFrameCount
+	}
+}
+
+// WithEchoStartupParsing logs echo banner and startup messages as structured events
+// with an event field, e.g. {"event":"server_start","scheme":"http","address":"[::]:1323"}.
+// Echo prints them to the output returned by Output or through Printf.
+func WithEchoStartupParsing() Setter {
+	return func(opts *Options) {
+		opts.startupParsing = true
+	}
+}
+
+// WithRawJSONFields embeds the given fields of log.JSON values as JSON, instead of escaping them,
+// when their value is a json.RawMessage, []byte or string holding valid JSON.
+func WithRawJSONFields(keys []string) Setter {
+	return func(opts *Options) {
+		fields := make(map[string]struct{}, len(opts.rawJSONFields)+len(keys))
+
+		for k := range opts.rawJSONFields {
+			fields[k] = struct{}{}
+		}
+
+		for _, k := range keys {
+			fields[k] = struct{}{}
+		}
+
+		opts.rawJSONFields = fields
+	}
+}
+
+// WithLineTransformer transforms each record before it is written to the output.
+// The function receives the record without the trailing newline, which is added back to the result.
+func WithLineTransformer(fn func(line []byte) []byte) Setter {
+	return func(opts *Options) {
+		opts.writers = append(opts.writers, func(out io.Writer) io.Writer {
+			return &lineTransformer{
+				out: out,
+				fn:  fn,
+			}
+		})
+	}
+}
+
+// WithAlwaysErrorField adds a null error field to records without an error, for consumers expecting a fixed schema.
+// Errors logged with Error are added as the error field.
+func WithAlwaysErrorField() Setter {
+	transform := WithLineTransformer(addNullError)
+
+	return func(opts *Options) {
+		opts.errorField = true
+		transform(opts)
+	}
+}
+
+// WithSortedFields sorts the top-level fields of each record by key, producing deterministic output, e.g. for golden files.
+// Records are parsed and re-serialized, so it is meant for tests rather than production.
+func WithSortedFields() Setter {
+	return WithLineTransformer(sortFields)
+}
+
+// WithCompactLevels writes levels as single characters, e.g. "I" for info and "W" for warn, to save bytes in high-volume logs.
+// Unlike zerolog.LevelFieldMarshalFunc, it affects only this logger.
+func WithCompactLevels() Setter {
+	return WithLineTransformer(compactLevel)
+}
+
+// WithFallback writes records to primary and, if that fails, to fallback.
+// It replaces the output, and the number of failed writes is reported by Logger.WriteErrors.
+// The failed writes are counted by the setter, across the loggers using it and the loggers derived from them.
+// It comes first in the chain of writer options whatever its position, so the writers of the other ones wrap it.
+func WithFallback(primary, fallback io.Writer) Setter {
+	w := &fallbackWriter{
+		primary:  primary,
+		fallback: fallback,
+	}
+
+	return func(opts *Options) {
+		opts.fallback = w
+		opts.writers = append([]func(w io.Writer) io.Writer{func(io.Writer) io.Writer {
+			return w
+		}}, opts.writers...)
+	}
+}
@@ -3,7 +3,12 @@ package lecho_test
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"strings"
 	"testing"
 	"time"
@@ -178,6 +183,29 @@ func TestWithLevel(t *testing.T) {
 `)
 }
 
+func TestWithLevelStringOrDefault(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithLevelStringOrDefault("WARNING", log.INFO))
+
+	l.Info("foo")
+
+	assert.Equal(t, b.String(), "")
+
+	b.Reset()
+	l = lecho.New(b, lecho.WithLevelStringOrDefault("garbage", log.INFO))
+
+	assert.Equal(t, b.String(), `{"level":"warn","message":"unknown level \"garbage\", using the default level"}
+`)
+	assert.Equal(t, l.Level(), log.INFO)
+
+	b.Reset()
+	l.Named("child").Debug("foo")
+	l.Info("bar")
+
+	assert.Equal(t, b.String(), `{"level":"info","message":"bar"}
+`, "should warn only once")
+}
+
 func TestWithPrefix(t *testing.T) {
 	b := &bytes.Buffer{}
 	l := lecho.New(b, lecho.WithPrefix("Test"))
@@ -185,6 +213,17 @@ func TestWithPrefix(t *testing.T) {
 	l.Warn("Foobar")
 
 	assert.Equal(t, b.String(), `{"level":"warn","prefix":"Test","message":"Foobar"}
+`)
+	assert.Equal(t, l.Prefix(), "Test")
+}
+
+func TestWithPrefix_Empty(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithPrefix(""))
+
+	l.Warn("Foobar")
+
+	assert.Equal(t, b.String(), `{"level":"warn","message":"Foobar"}
 `)
 }
 
@@ -208,3 +247,561 @@ func TestWithTimestamp(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, log.Time)
 }
+
+func TestWithCompactErrors(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithCompactErrors())
+
+	l.Error("validation failed:\n\tname is required\r\n\tage is invalid")
+
+	assert.Equal(t, b.String(), `{"level":"error","message":"validation failed:  name is required  age is invalid"}
+`)
+
+	b.Reset()
+
+	l.Errorf("%s:\n%s", "failed", "reason")
+
+	assert.Equal(t, b.String(), `{"level":"error","message":"failed: reason"}
+`)
+}
+
+type codedError struct {
+	Code    int
+	Details string
+}
+
+func (e *codedError) Error() string {
+	return e.Details
+}
+
+func TestWithErrorMarshalFunc(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithErrorMarshalFunc(func(err error) interface{} {
+		if ce, ok := err.(*codedError); ok {
+			return map[string]interface{}{
+				"code":    ce.Code,
+				"message": ce.Details,
+			}
+		}
+
+		return err.Error()
+	}))
+
+	l.Error(&codedError{Code: 404, Details: "not found"})
+
+	assert.Equal(t, b.String(), `{"level":"error","error":{"code":404,"message":"not found"},"message":"not found"}
+`)
+
+	b.Reset()
+
+	l.Error("foo", "bar")
+
+	assert.Equal(t, b.String(), `{"level":"error","message":"foobar"}
+`)
+}
+
+func TestWithTee(t *testing.T) {
+	b := &bytes.Buffer{}
+	errs := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithTee(errs, zerolog.WarnLevel))
+
+	l.Info("foo")
+	l.Warn("bar")
+
+	assert.Equal(t, b.String(), `{"level":"info","message":"foo"}
+{"level":"warn","message":"bar"}
+`)
+	assert.Equal(t, errs.String(), `{"level":"warn","message":"bar"}
+`)
+
+	b.Reset()
+	errs.Reset()
+
+	out := &bytes.Buffer{}
+	l.SetOutput(out)
+	l.Error("baz")
+
+	assert.Empty(t, b.String())
+	assert.Equal(t, out.String(), `{"level":"error","message":"baz"}
+`)
+	assert.Equal(t, errs.String(), `{"level":"error","message":"baz"}
+`)
+}
+
+func TestWithTimeFunc(t *testing.T) {
+	clocks := map[string]time.Time{
+		"first":  time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		"second": time.Date(2021, 6, 15, 12, 30, 0, 0, time.UTC),
+	}
+
+	for name, now := range clocks {
+		name, now := name, now
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			b := &bytes.Buffer{}
+			l := lecho.New(b, lecho.WithTimeFunc(func() time.Time {
+				return now
+			}))
+
+			for i := 0; i < 100; i++ {
+				b.Reset()
+
+				l.Print("foobar")
+
+				entry := struct {
+					Time time.Time `json:"time"`
+				}{}
+
+				assert.NoError(t, json.Unmarshal(b.Bytes(), &entry))
+				assert.True(t, now.Equal(entry.Time))
+			}
+		})
+	}
+}
+
+func TestWithLevelColors(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithLevelColors(map[zerolog.Level]int{
+		zerolog.WarnLevel: 35,
+	}))
+
+	l.Warn("foo")
+
+	assert.Contains(t, b.String(), "\x1b[35mWRN\x1b[0m")
+	assert.Contains(t, b.String(), "foo")
+
+	b.Reset()
+
+	l.Info("bar")
+
+	assert.Contains(t, b.String(), "\x1b[32mINF\x1b[0m")
+	assert.Contains(t, b.String(), "bar")
+}
+
+func TestWithBufferedWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithBufferedWriter(1024))
+
+	l.Info("foo")
+	l.Info("bar")
+
+	assert.Empty(t, b.String())
+
+	assert.NoError(t, l.Flush())
+	assert.Equal(t, b.String(), `{"level":"info","message":"foo"}
+{"level":"info","message":"bar"}
+`)
+}
+
+func BenchmarkWithBufferedWriter(b *testing.B) {
+	for name, setters := range map[string][]lecho.Setter{
+		"unbuffered": nil,
+		"buffered":   {lecho.WithBufferedWriter(64 << 10)},
+	} {
+		b.Run(name, func(b *testing.B) {
+			f, err := os.Create(filepath.Join(b.TempDir(), "log"))
+
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			defer f.Close()
+
+			l := lecho.New(f, setters...)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				l.Info("foobar")
+			}
+
+			if err := l.Flush(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+// stackError records the functions of the stack where it was created, for zerolog.ErrorStackMarshaler.
+type stackError struct {
+	funcs []string
+}
+
+func (e *stackError) Error() string {
+	return "stack error"
+}
+
+func newStackError() error {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	err := &stackError{}
+
+	for {
+		frame, more := frames.Next()
+		err.funcs = append(err.funcs, frame.Function)
+
+		if !more {
+			return err
+		}
+	}
+}
+
+func marshalStack(err error) interface{} {
+	var se *stackError
+
+	if !errors.As(err, &se) {
+		return nil
+	}
+
+	stack := make([]map[string]string, 0, len(se.funcs))
+
+	for _, fn := range se.funcs {
+		stack = append(stack, map[string]string{"func": fn})
+	}
+
+	return stack
+}
+
+func TestWithStack(t *testing.T) {
+	type Log struct {
+		Error string `json:"error"`
+		Stack []struct {
+			Func string `json:"func"`
+		} `json:"stack"`
+	}
+
+	defer func(marshaler func(err error) interface{}) {
+		zerolog.ErrorStackMarshaler = marshaler
+	}(zerolog.ErrorStackMarshaler)
+
+	zerolog.ErrorStackMarshaler = marshalStack
+
+	t.Run("should add the stack of the error", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithStack())
+
+		l.Error(newStackError())
+
+		entry := &Log{}
+		assert.NoError(t, json.Unmarshal(b.Bytes(), entry))
+		assert.Equal(t, "stack error", entry.Error)
+
+		if assert.NotEmpty(t, entry.Stack) {
+			assert.Equal(t, "github.com/ziflex/lecho/v3_test.newStackError", entry.Stack[0].Func)
+		}
+	})
+
+	t.Run("should skip the leading frames of the stack", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithStack(), lecho.WithStackSkip(1))
+
+		l.Error(newStackError())
+
+		entry := &Log{}
+		assert.NoError(t, json.Unmarshal(b.Bytes(), entry))
+
+		if assert.NotEmpty(t, entry.Stack) {
+			assert.Equal(t, "github.com/ziflex/lecho/v3_test.TestWithStack.func3", entry.Stack[0].Func)
+		}
+	})
+
+	t.Run("should not enable the stack", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithStackSkip(0))
+
+		l.Error(newStackError())
+
+		assert.Equal(t, `{"level":"error","message":"stack error"}
+`, b.String())
+	})
+
+	t.Run("should not add a stack without a marshaler", func(t *testing.T) {
+		zerolog.ErrorStackMarshaler = nil
+		defer func() {
+			zerolog.ErrorStackMarshaler = marshalStack
+		}()
+
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithStack())
+
+		l.Error(newStackError())
+
+		assert.Equal(t, `{"level":"error","error":"stack error","message":"stack error"}
+`, b.String())
+	})
+}
+
+func TestWithStackSkip(t *testing.T) {
+	type Log struct {
+		Stack []struct {
+			Func   string `json:"func"`
+			Source string `json:"source"`
+		} `json:"stack"`
+	}
+
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithStackSkip(1))
+	logStack := func(msg string) {
+		l.Stack(log.INFO, msg)
+	}
+
+	logStack("foo")
+
+	entry := &Log{}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), entry))
+
+	if assert.NotEmpty(t, entry.Stack) {
+		assert.Equal(t, "github.com/ziflex/lecho/v3_test.TestWithStackSkip", entry.Stack[0].Func)
+		assert.Equal(t, "options_test.go", filepath.Base(entry.Stack[0].Source))
+	}
+}
+
+func TestWithLineTransformer(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithLineTransformer(func(line []byte) []byte {
+		return []byte(fmt.Sprintf("%d:%s", len(line), line))
+	}))
+
+	l.Info("foo")
+	l.Warn("bar")
+
+	assert.Equal(t, b.String(), `32:{"level":"info","message":"foo"}
+32:{"level":"warn","message":"bar"}
+`)
+}
+
+type brokenWriter struct{}
+
+func (brokenWriter) Write([]byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestWithFallback(t *testing.T) {
+	fallback := &bytes.Buffer{}
+	l := lecho.New(os.Stdout, lecho.WithFallback(brokenWriter{}, fallback))
+
+	l.Info("foo")
+	l.Warn("bar")
+
+	assert.Equal(t, fallback.String(), `{"level":"info","message":"foo"}
+{"level":"warn","message":"bar"}
+`)
+	assert.Equal(t, l.WriteErrors(), uint64(2))
+
+	primary := &bytes.Buffer{}
+	fallback.Reset()
+	l = lecho.New(os.Stdout, lecho.WithFallback(primary, fallback))
+
+	l.Info("foo")
+
+	assert.Equal(t, primary.String(), `{"level":"info","message":"foo"}
+`)
+	assert.Empty(t, fallback.String())
+	assert.Zero(t, l.WriteErrors())
+
+	fallback.Reset()
+	l = lecho.New(os.Stdout, lecho.WithFallback(brokenWriter{}, fallback), lecho.WithBufferedWriter(1024))
+
+	l.Info("foo")
+
+	assert.NoError(t, l.Flush())
+	assert.Equal(t, fallback.String(), `{"level":"info","message":"foo"}
+`)
+	assert.Equal(t, uint64(1), l.WriteErrors(), "should count the failed writes behind other writers")
+
+	tee := &bytes.Buffer{}
+	fallback.Reset()
+	l = lecho.New(os.Stdout, lecho.WithTee(tee, zerolog.InfoLevel), lecho.WithFallback(brokenWriter{}, fallback))
+
+	l.Info("foo")
+
+	assert.Equal(t, fallback.String(), `{"level":"info","message":"foo"}
+`)
+	assert.Equal(t, tee.String(), `{"level":"info","message":"foo"}
+`, "should keep the writers of the options before it")
+}
+
+func TestWithEchoStartupParsing(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithEchoStartupParsing())
+
+	l.Printf("⇨ http server started on %s\n", "[::]:1323")
+	fmt.Fprintf(l.Output(), "⇨ https server started on %s\n", "\x1b[32m127.0.0.1:8443\x1b[0m")
+	fmt.Fprintf(l.Output(), "/___/\\__/_//_/\\___/ %s\nHigh performance, minimalist Go web framework\n%s\n", "v4.10.0", "https://echo.labstack.com")
+	l.Printf("foo %s", "bar")
+
+	assert.Equal(t, b.String(), `{"level":"info","event":"server_start","scheme":"http","address":"[::]:1323","message":"http server started"}
+{"level":"info","event":"server_start","scheme":"https","address":"127.0.0.1:8443","message":"https server started"}
+{"level":"info","event":"server_banner","version":"v4.10.0","message":"echo"}
+{"level":"-","message":"foo bar"}
+`)
+}
+
+func TestWithAlwaysErrorField(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithAlwaysErrorField())
+
+	l.Info("foo")
+	l.Error(errors.New("bar"))
+	l.Infoj(map[string]interface{}{"nested": map[string]interface{}{"error": "baz"}})
+
+	assert.Equal(t, b.String(), `{"level":"info","message":"foo","error":null}
+{"level":"error","error":"bar","message":"bar"}
+{"level":"info","nested":{"error":"baz"},"error":null}
+`)
+
+	b.Reset()
+	zl := l.Unwrap()
+	zl.Error().Err(errors.New("qux")).Send()
+
+	assert.Equal(t, b.String(), `{"level":"error","error":"qux"}
+`)
+}
+
+func TestWithRawJSONFields(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithRawJSONFields([]string{"payload", "body", "invalid"}))
+
+	l.Infoj(log.JSON{"payload": json.RawMessage(`{"foo":"bar"}`)})
+	l.Infoj(log.JSON{"body": `[1,2]`})
+	l.Infoj(log.JSON{"invalid": "{foo"})
+	l.Infoj(log.JSON{"other": `{"foo":"bar"}`})
+
+	assert.Equal(t, b.String(), `{"level":"info","payload":{"foo":"bar"}}
+{"level":"info","body":[1,2]}
+{"level":"info","invalid":"{foo"}
+{"level":"info","other":"{\"foo\":\"bar\"}"}
+`)
+}
+
+func TestWithFieldPrefix(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(
+		b,
+		lecho.WithTimeFunc(func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) }),
+		lecho.WithFieldPrefix("app_"),
+		lecho.WithField("user_id", 1),
+		lecho.WithFields(map[string]interface{}{"tenant": "foo"}),
+	)
+	l.AddFields(map[string]interface{}{"region": "eu"})
+
+	l.Info("bar")
+
+	assert.Equal(t, b.String(), `{"level":"info","app_user_id":1,"app_tenant":"foo","app_region":"eu","time":"2020-01-01T00:00:00Z","message":"bar"}
+`)
+	assert.Equal(t, l.Fields(), map[string]interface{}{"app_user_id": 1, "app_tenant": "foo", "app_region": "eu"})
+}
+
+func TestWithSchemaVersion(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithFieldPrefix("app_"), lecho.WithSchemaVersion("v2"))
+
+	l.Info("foo")
+
+	assert.Equal(t, b.String(), `{"level":"info","log_schema":"v2","message":"foo"}
+`)
+}
+
+func TestWithSortedFields(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithSortedFields(), lecho.WithField("zoo", 1), lecho.WithField("bar", "baz"))
+
+	l.Infoj(log.JSON{"nested": map[string]interface{}{"y": 1, "x": []int{2, 3}}, "abc": nil})
+	l.Warn("foo")
+
+	assert.Equal(t, b.String(), `{"abc":null,"bar":"baz","level":"info","nested":{"x":[2,3],"y":1},"zoo":1}
+{"bar":"baz","level":"warn","message":"foo","zoo":1}
+`)
+}
+
+func TestWithBuildInfo(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithBuildInfo("v1.2.3", "abc123", ""))
+
+	l.Info("foo")
+
+	assert.Equal(t, b.String(), `{"level":"info","version":"v1.2.3","commit":"abc123","message":"foo"}
+`)
+}
+
+func TestWithVCSInfoFrom(t *testing.T) {
+	t.Run("should add the VCS info", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithVCSInfoFrom(&debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/app", Version: "v1.0.0"},
+			Settings: []debug.BuildSetting{
+				{Key: "vcs", Value: "git"},
+				{Key: "vcs.revision", Value: "abc123"},
+				{Key: "vcs.time", Value: "2020-01-02T03:04:05Z"},
+			},
+		}))
+
+		l.Info("foo")
+
+		assert.Equal(t, b.String(), `{"level":"info","version":"v1.0.0","commit":"abc123","build_date":"2020-01-02T03:04:05Z","message":"foo"}
+`)
+	})
+
+	t.Run("should skip the development version", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithVCSInfoFrom(&debug.BuildInfo{
+			Main: debug.Module{Path: "example.com/app", Version: "(devel)"},
+		}))
+
+		l.Info("foo")
+
+		assert.Equal(t, b.String(), `{"level":"info","message":"foo"}
+`)
+	})
+
+	t.Run("should ignore missing build info", func(t *testing.T) {
+		b := &bytes.Buffer{}
+		l := lecho.New(b, lecho.WithVCSInfoFrom(nil))
+
+		l.Info("foo")
+
+		assert.Equal(t, b.String(), `{"level":"info","message":"foo"}
+`)
+	})
+}
+
+func TestWithWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithWriter(w))
+
+	l.Info("foo")
+	l.Print("bar")
+
+	assert.Equal(t, w.String(), `{"level":"info","message":"foo"}
+{"level":"-","message":"bar"}
+`)
+	assert.Equal(t, w.String(), b.String())
+}
+
+func TestWithCompactLevels(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b, lecho.WithCompactLevels(), lecho.WithLevel(log.DEBUG))
+
+	l.Debug("foo")
+	l.Info("foo")
+	l.Warn("foo")
+	l.Error("foo")
+	l.Print("foo")
+
+	assert.Equal(t, b.String(), `{"level":"D","message":"foo"}
+{"level":"I","message":"foo"}
+{"level":"W","message":"foo"}
+{"level":"E","message":"foo"}
+{"level":"-","message":"foo"}
+`)
+
+	b.Reset()
+	lecho.New(b).Info("foo")
+
+	assert.Equal(t, b.String(), `{"level":"info","message":"foo"}
+`, "should not affect other loggers")
+}
@@ -0,0 +1,23 @@
+// Package otel provides a lecho middleware enricher correlating request logs with OpenTelemetry traces.
+package otel
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Enricher adds trace_id, span_id and trace_sampled from the span context of the request, if it is valid.
+// It is meant to be used as lecho.Config.Enricher after the tracing middleware.
+func Enricher(c echo.Context, logger zerolog.Context) zerolog.Context {
+	sc := trace.SpanContextFromContext(c.Request().Context())
+
+	if !sc.IsValid() {
+		return logger
+	}
+
+	return logger.
+		Str("trace_id", sc.TraceID().String()).
+		Str("span_id", sc.SpanID().String()).
+		Bool("trace_sampled", sc.IsSampled())
+}
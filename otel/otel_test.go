@@ -0,0 +1,57 @@
+package otel_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ziflex/lecho/v3"
+	"github.com/ziflex/lecho/v3/otel"
+)
+
+func TestEnricher(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+
+	e := echo.New()
+	b := &bytes.Buffer{}
+	m := lecho.Middleware(lecho.Config{
+		Logger:   lecho.New(b),
+		Enricher: otel.Enricher,
+	})
+	handler := m(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, flags := range []trace.TraceFlags{trace.FlagsSampled, 0} {
+		b.Reset()
+
+		sc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    traceID,
+			SpanID:     spanID,
+			TraceFlags: flags,
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(trace.ContextWithSpanContext(req.Context(), sc))
+
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())))
+		assert.Contains(t, b.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"`)
+
+		if flags.IsSampled() {
+			assert.Contains(t, b.String(), `"trace_sampled":true`)
+		} else {
+			assert.Contains(t, b.String(), `"trace_sampled":false`)
+		}
+	}
+
+	b.Reset()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())))
+	assert.NotContains(t, b.String(), "trace_", "should omit fields without a span context")
+}
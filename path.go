@@ -0,0 +1,23 @@
+package lecho
+
+import (
+	"regexp"
+	"strings"
+)
+
+// idSegmentPattern matches path segments that are numbers or UUIDs.
+var idSegmentPattern = regexp.MustCompile(`^(?:\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+
+// DefaultPathNormalizer replaces the numeric and UUID segments of the path with ":id",
+// e.g. "/users/:id/orders/:id" for "/users/123/orders/3f2b8e6a-1c4d-4e5f-8a9b-0c1d2e3f4a5b".
+func DefaultPathNormalizer(path string) string {
+	segments := strings.Split(path, "/")
+
+	for i, segment := range segments {
+		if idSegmentPattern.MatchString(segment) {
+			segments[i] = ":id"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
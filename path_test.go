@@ -0,0 +1,21 @@
+package lecho_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestDefaultPathNormalizer(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/users/123": "/users/:id",
+		"/users/123/orders/3F2B8E6A-1C4D-4E5F-8A9B-0C1D2E3F4A5B": "/users/:id/orders/:id",
+		"/static/app.v2.js": "/static/app.v2.js",
+		"/users/123abc/":    "/users/123abc/",
+		"/":                 "/",
+	} {
+		assert.Equal(t, expected, lecho.DefaultPathNormalizer(path), path)
+	}
+}
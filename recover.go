@@ -0,0 +1,126 @@
+package lecho
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// RecoverConfig is the configuration for the recover middleware.
+	RecoverConfig struct {
+		// Logger is a custom instance of the logger to use.
+		// The request logger set by Middleware takes precedence.
+		Logger *Logger
+		// Skipper defines a function to skip middleware.
+		Skipper middleware.Skipper
+		// PanicFlag indicates whether to add a "panic": true field to the log record.
+		PanicFlag bool
+		// LogPanicCount indicates whether to add panic_count, the number of panics recovered by the middleware so far, to the log record.
+		LogPanicCount bool
+		// PanicKey is the key name to use for the recovered value in a log record. Defaults to "panic_value".
+		PanicKey string
+		// LevelFunc is a function that returns the level to log the recovered value at. Defaults to error level.
+		LevelFunc func(recovered interface{}) zerolog.Level
+		// StackSize is the size of the stack to be logged. Defaults to 4 KB.
+		StackSize int
+		// DisableStack indicates whether to omit the stack trace.
+		DisableStack bool
+	}
+)
+
+// Recover returns a middleware which recovers from panics, logs them and passes the error to the global error handler.
+func Recover(config RecoverConfig) echo.MiddlewareFunc {
+	if config.Skipper == nil {
+		config.Skipper = middleware.DefaultSkipper
+	}
+
+	if config.Logger == nil {
+		config.Logger = New(os.Stdout, WithTimestamp())
+	}
+
+	if config.PanicKey == "" {
+		config.PanicKey = "panic_value"
+	}
+
+	if config.LevelFunc == nil {
+		config.LevelFunc = func(interface{}) zerolog.Level {
+			return zerolog.ErrorLevel
+		}
+	}
+
+	if config.StackSize <= 0 {
+		config.StackSize = 4 << 10
+	}
+
+	// number of panics recovered, including the current one
+	var panics int64
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			defer func() {
+				r := recover()
+
+				if r == nil {
+					return
+				}
+
+				if r == http.ErrAbortHandler {
+					panic(r)
+				}
+
+				err, ok := r.(error)
+
+				if !ok {
+					err = fmt.Errorf("%v", r)
+				}
+
+				logger, ok := c.Logger().(*Logger)
+
+				if !ok {
+					logger = config.Logger
+				}
+
+				count := atomic.AddInt64(&panics, 1)
+				evt := logger.withLevel(config.LevelFunc(r))
+
+				if config.PanicFlag {
+					evt.Bool("panic", true)
+				}
+
+				if config.LogPanicCount {
+					evt.Int64("panic_count", count)
+				}
+
+				if _, ok := r.(error); ok {
+					evt.AnErr(config.PanicKey, err)
+				} else {
+					evt.Interface(config.PanicKey, r)
+				}
+
+				if !config.DisableStack {
+					stack := make([]byte, config.StackSize)
+					stack = stack[:runtime.Stack(stack, false)]
+
+					evt.Bytes("stack", stack)
+				}
+
+				evt.Msg("panic recovered")
+
+				c.Error(err)
+			}()
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package lecho_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestRecover(t *testing.T) {
+	type Log struct {
+		Level      string      `json:"level"`
+		Panic      bool        `json:"panic"`
+		PanicValue interface{} `json:"panic_value"`
+		Stack      string      `json:"stack"`
+		Message    string      `json:"message"`
+	}
+
+	t.Run("should recover and call error handler", func(t *testing.T) {
+		var called bool
+		e := echo.New()
+		e.HTTPErrorHandler = func(err error, c echo.Context) {
+			called = true
+
+			assert.EqualError(t, err, "foo")
+		}
+		b := &bytes.Buffer{}
+		m := lecho.Recover(lecho.RecoverConfig{
+			Logger: lecho.New(b),
+		})
+
+		handler := m(func(c echo.Context) error {
+			panic("foo")
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		err := handler(e.NewContext(req, httptest.NewRecorder()))
+
+		assert.NoError(t, err, "should not return error")
+		assert.True(t, called, "should call error handler")
+
+		entry := &Log{}
+		assert.NoError(t, json.Unmarshal(b.Bytes(), entry))
+		assert.Equal(t, "error", entry.Level)
+		assert.False(t, entry.Panic)
+		assert.Equal(t, "foo", entry.PanicValue)
+		assert.Contains(t, entry.Stack, "recover_test.go")
+		assert.Equal(t, "panic recovered", entry.Message)
+	})
+
+	t.Run("should log the panic count", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Recover(lecho.RecoverConfig{
+			Logger:        lecho.New(b),
+			LogPanicCount: true,
+			DisableStack:  true,
+		})
+
+		handler := m(func(c echo.Context) error {
+			panic("foo")
+		})
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			_ = handler(e.NewContext(req, httptest.NewRecorder()))
+		}
+
+		assert.Equal(t, `{"level":"error","panic_count":1,"panic_value":"foo","message":"panic recovered"}
+{"level":"error","panic_count":2,"panic_value":"foo","message":"panic recovered"}
+`, b.String())
+	})
+
+	t.Run("should use LevelFunc", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		m := lecho.Recover(lecho.RecoverConfig{
+			Logger:       lecho.New(b),
+			PanicFlag:    true,
+			DisableStack: true,
+			LevelFunc: func(recovered interface{}) zerolog.Level {
+				if _, ok := recovered.(runtime.Error); ok {
+					return zerolog.ErrorLevel
+				}
+
+				return zerolog.WarnLevel
+			},
+		})
+
+		handler := m(func(c echo.Context) error {
+			var m map[string]int
+			m["foo"] = 1
+
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())))
+
+		entry := &Log{}
+		assert.NoError(t, json.Unmarshal(b.Bytes(), entry))
+		assert.Equal(t, "error", entry.Level)
+		assert.True(t, entry.Panic)
+		assert.Equal(t, "assignment to entry in nil map", entry.PanicValue)
+		assert.Empty(t, entry.Stack)
+
+		b.Reset()
+
+		handler = m(func(c echo.Context) error {
+			panic(map[string]int{"code": 42})
+		})
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())))
+
+		entry = &Log{}
+		assert.NoError(t, json.Unmarshal(b.Bytes(), entry))
+		assert.Equal(t, "warn", entry.Level)
+		assert.True(t, entry.Panic)
+		assert.Equal(t, map[string]interface{}{"code": float64(42)}, entry.PanicValue)
+	})
+
+	t.Run("should use request logger", func(t *testing.T) {
+		e := echo.New()
+		b := &bytes.Buffer{}
+		l := lecho.New(b)
+		m := lecho.Middleware(lecho.Config{
+			Logger: l,
+		})
+		r := lecho.Recover(lecho.RecoverConfig{
+			Logger:       lecho.New(&bytes.Buffer{}),
+			DisableStack: true,
+		})
+
+		handler := m(r(func(c echo.Context) error {
+			panic("foo")
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderXRequestID, "123")
+		assert.NoError(t, handler(e.NewContext(req, httptest.NewRecorder())))
+
+		assert.Contains(t, b.String(), `{"level":"error","id":"123","panic_value":"foo","message":"panic recovered"}`)
+	})
+}
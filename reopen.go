@@ -0,0 +1,82 @@
+package lecho
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"reflect"
+)
+
+// ReopenOnSignal replaces the output with the one returned by openFn each time sig is received,
+// e.g. SIGHUP sent by logrotate, and closes the previous output if it implements io.Closer.
+// The loggers derived from l switch to the new output too.
+// If openFn fails, the previous output is kept and the failure is logged.
+// The returned function stops handling the signal.
+func (l *Logger) ReopenOnSignal(sig os.Signal, openFn func() (io.Writer, error)) func() {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	signal.Notify(signals, sig)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				l.reopen(openFn)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
+
+func (l *Logger) reopen(openFn func() (io.Writer, error)) {
+	out, err := openFn()
+
+	if err != nil {
+		l.errEvent(err).Msg("failed to reopen output")
+
+		return
+	}
+
+	l.mu.Lock()
+
+	if l.o == nil {
+		l.setOutput(out)
+		l.mu.Unlock()
+
+		return
+	}
+
+	// the output is swapped in place, so the loggers derived from l, e.g. those of in-flight requests, switch too
+	_ = flushWriter(l.w)
+	prev, ok := l.o.swap(out, l.opts.writers[:l.shared], l.format)
+	l.mu.Unlock()
+
+	if !ok {
+		// the logger is closed, the new output is not used
+		prev = out
+	} else if sameWriter(prev, out) {
+		return
+	}
+
+	if c, ok := prev.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// sameWriter reports whether a and b are the same writer, without panicking on uncomparable types.
+func sameWriter(a, b io.Writer) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	t := reflect.TypeOf(a)
+
+	return t == reflect.TypeOf(b) && t.Comparable() && a == b
+}
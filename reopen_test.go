@@ -0,0 +1,156 @@
+package lecho_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestLogger_ReopenOnSignal(t *testing.T) {
+	self, err := os.FindProcess(os.Getpid())
+
+	if err != nil {
+		t.Skip(err)
+	}
+
+	first := &bytes.Buffer{}
+	second := &bytes.Buffer{}
+	opened := make(chan struct{}, 2)
+	outputs := []io.Writer{nil, zerolog.SyncWriter(second)}
+	errs := []error{errors.New("disk full"), nil}
+
+	l := lecho.New(zerolog.SyncWriter(first))
+	stop := l.ReopenOnSignal(syscall.SIGHUP, func() (io.Writer, error) {
+		out, err := outputs[0], errs[0]
+		outputs, errs = outputs[1:], errs[1:]
+		opened <- struct{}{}
+
+		return out, err
+	})
+	defer stop()
+
+	for i := 0; i < 2; i++ {
+		if err := self.Signal(syscall.SIGHUP); err != nil {
+			t.Skip(err)
+		}
+
+		select {
+		case <-opened:
+		case <-time.After(time.Second):
+			t.Fatal("output was not reopened")
+		}
+	}
+
+	// the output is swapped after openFn returns
+	assert.Eventually(t, func() bool {
+		l.Info("foo")
+
+		return second.Len() > 0
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Contains(t, first.String(), `{"level":"error","error":"disk full","message":"failed to reopen output"}`)
+	assert.Contains(t, second.String(), `"message":"foo"`)
+}
+
+func TestLogger_ReopenOnSignal_Copy(t *testing.T) {
+	self, err := os.FindProcess(os.Getpid())
+
+	if err != nil {
+		t.Skip(err)
+	}
+
+	first := &closingBuffer{}
+	second := &closingBuffer{}
+	opened := make(chan struct{}, 1)
+
+	l := lecho.New(first)
+	c := l.Copy()
+	stop := c.ReopenOnSignal(syscall.SIGHUP, func() (io.Writer, error) {
+		opened <- struct{}{}
+
+		return second, nil
+	})
+	defer stop()
+
+	if err := self.Signal(syscall.SIGHUP); err != nil {
+		t.Skip(err)
+	}
+
+	select {
+	case <-opened:
+	case <-time.After(time.Second):
+		t.Fatal("output was not reopened")
+	}
+
+	assert.Eventually(t, func() bool {
+		c.Info("copy")
+
+		return second.Len() > 0
+	}, time.Second, 10*time.Millisecond)
+
+	l.Info("original")
+
+	assert.False(t, first.isClosed(), "should not close the output of the original")
+	assert.Equal(t, `{"level":"info","message":"original"}
+`, first.String(), "should keep the output of the original")
+}
+
+// funcWriter is not comparable, unlike most writers.
+type funcWriter func(p []byte) (int, error)
+
+func (f funcWriter) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestLogger_ReopenOnSignal_Derived(t *testing.T) {
+	self, err := os.FindProcess(os.Getpid())
+
+	if err != nil {
+		t.Skip(err)
+	}
+
+	first := &closingBuffer{}
+	second := &closingBuffer{}
+	opened := make(chan struct{}, 1)
+
+	l := lecho.New(first, lecho.WithBufferedWriter(1024))
+	child := l.Named("child")
+	stop := l.ReopenOnSignal(syscall.SIGHUP, func() (io.Writer, error) {
+		opened <- struct{}{}
+
+		return funcWriter(second.Write), nil
+	})
+	defer stop()
+
+	child.Info("foo")
+
+	if err := self.Signal(syscall.SIGHUP); err != nil {
+		t.Skip(err)
+	}
+
+	select {
+	case <-opened:
+	case <-time.After(time.Second):
+		t.Fatal("output was not reopened")
+	}
+
+	assert.Eventually(t, first.isClosed, time.Second, 10*time.Millisecond, "should close the previous output")
+
+	child.Info("bar")
+	assert.NoError(t, l.Flush())
+
+	assert.Equal(t, `{"level":"info","logger":"child","message":"foo"}
+`, first.String(), "should flush the previous output before closing it")
+	assert.Equal(t, `{"level":"info","logger":"child","message":"bar"}
+`, second.String(), "should switch the derived loggers to the new output")
+	assert.Zero(t, first.rejected)
+}
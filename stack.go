@@ -0,0 +1,114 @@
+package lecho
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	lechoPkg   = reflect.TypeOf(Logger{}).PkgPath() + "."
+	zerologPkg = reflect.TypeOf(zerolog.Logger{}).PkgPath() + "."
+)
+
+// stackFrame is a single frame of the stack, marshaled the same way as zerolog's pkgerrors.
+type stackFrame struct {
+	function string
+	source   string
+	line     int
+}
+
+func (f stackFrame) MarshalZerologObject(e *zerolog.Event) {
+	e.Str("func", f.function)
+	e.Str("line", strconv.Itoa(f.line))
+	e.Str("source", f.source)
+}
+
+// stackFrames holds the frames of the stack.
+type stackFrames []stackFrame
+
+func (s stackFrames) MarshalZerologArray(a *zerolog.Array) {
+	for _, f := range s {
+		a.Object(f)
+	}
+}
+
+// callers returns the current stack without the leading lecho and zerolog frames and the given number of frames after them.
+func callers(skip int) stackFrames {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	stack := make(stackFrames, 0, n)
+	internal := true
+
+	for {
+		frame, more := frames.Next()
+
+		if internal && isInternalFrame(frame.Function) {
+			if !more {
+				break
+			}
+
+			continue
+		}
+
+		internal = false
+
+		if skip > 0 {
+			skip--
+		} else {
+			stack = append(stack, stackFrame{
+				function: frame.Function,
+				source:   frame.File,
+				line:     frame.Line,
+			})
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return stack
+}
+
+// errorStack adds the stack of the error returned by zerolog.ErrorStackMarshaler, like zerolog.Event.Stack,
+// without the given number of leading frames when the stack is a slice of frames.
+func errorStack(evt *zerolog.Event, err error, skip int) *zerolog.Event {
+	if zerolog.ErrorStackMarshaler == nil {
+		return evt
+	}
+
+	stack := zerolog.ErrorStackMarshaler(err)
+
+	if v := reflect.ValueOf(stack); skip > 0 && v.Kind() == reflect.Slice {
+		if skip > v.Len() {
+			skip = v.Len()
+		}
+
+		stack = v.Slice(skip, v.Len()).Interface()
+	}
+
+	switch m := stack.(type) {
+	case nil:
+	case zerolog.LogObjectMarshaler:
+		evt = evt.Object(zerolog.ErrorStackFieldName, m)
+	case error:
+		if v := reflect.ValueOf(m); v.Kind() != reflect.Ptr || !v.IsNil() {
+			evt = evt.Str(zerolog.ErrorStackFieldName, m.Error())
+		}
+	case string:
+		evt = evt.Str(zerolog.ErrorStackFieldName, m)
+	default:
+		evt = evt.Interface(zerolog.ErrorStackFieldName, m)
+	}
+
+	return evt
+}
+
+func isInternalFrame(function string) bool {
+	return strings.HasPrefix(function, lechoPkg) || strings.HasPrefix(function, zerologPkg)
+}
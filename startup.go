@@ -0,0 +1,59 @@
+package lecho
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	ansiPattern    = regexp.MustCompile("\x1b\\[[0-9;]*m")
+	startupPattern = regexp.MustCompile(`⇨ (https?) server started on (\S+)`)
+	versionPattern = regexp.MustCompile(`v\d+\.\d+\.\d+\S*`)
+)
+
+// startupWriter logs echo startup messages written to the output as structured events.
+type startupWriter struct {
+	logger *Logger
+	out    io.Writer
+}
+
+func (w startupWriter) Write(p []byte) (int, error) {
+	if w.logger.logStartup(string(p)) {
+		return len(p), nil
+	}
+
+	return w.out.Write(p)
+}
+
+// logStartup logs msg as a structured event if it is an echo banner or startup message.
+// It reports whether msg was recognized.
+func (l *Logger) logStartup(msg string) bool {
+	msg = ansiPattern.ReplaceAllString(msg, "")
+
+	if m := startupPattern.FindStringSubmatch(msg); m != nil {
+		l.event((*zerolog.Logger).Info).
+			Str("event", "server_start").
+			Str("scheme", m[1]).
+			Str("address", m[2]).
+			Msg(m[1] + " server started")
+
+		return true
+	}
+
+	if strings.Contains(msg, "High performance, minimalist Go web framework") {
+		evt := l.event((*zerolog.Logger).Info).Str("event", "server_banner")
+
+		if v := versionPattern.FindString(msg); v != "" {
+			evt = evt.Str("version", v)
+		}
+
+		evt.Msg("echo")
+
+		return true
+	}
+
+	return false
+}
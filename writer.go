@@ -0,0 +1,547 @@
+package lecho
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/labstack/gommon/log"
+	"github.com/rs/zerolog"
+)
+
+// maxLineSize is the size above which a line written to a levelWriter is logged without waiting for its newline.
+const maxLineSize = 64 * 1024
+
+// levelWriter is an io.WriteCloser that logs each written line at a fixed level.
+// A line split across writes is buffered until its newline, or until Close.
+type levelWriter struct {
+	mu     sync.Mutex
+	logger *Logger
+	level  zerolog.Level
+	buf    []byte
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	start := 0
+
+	for {
+		i := bytes.IndexByte(w.buf[start:], '\n')
+
+		if i < 0 {
+			break
+		}
+
+		w.log(w.buf[start : start+i])
+		start += i + 1
+	}
+
+	// the partial line is moved to the front, so the buffer is reused
+	w.buf = w.buf[:copy(w.buf, w.buf[start:])]
+
+	if len(w.buf) > maxLineSize {
+		w.log(w.buf)
+		w.buf = w.buf[:0]
+	}
+
+	return len(p), nil
+}
+
+// Close logs the buffered line, if any.
+func (w *levelWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.log(w.buf)
+	w.buf = nil
+
+	return nil
+}
+
+func (w *levelWriter) log(line []byte) {
+	if line = bytes.TrimRight(line, "\r"); len(line) > 0 {
+		w.logger.withLevel(w.level).Msg(string(line))
+	}
+}
+
+// WriterLevel returns an io.WriteCloser that logs each written line at the given level.
+// A line without a trailing newline is logged by Close.
+func (l *Logger) WriterLevel(level log.Lvl) io.WriteCloser {
+	zlvl, _ := MatchEchoLevel(level)
+
+	return &levelWriter{
+		logger: l,
+		level:  zlvl,
+	}
+}
+
+// wrapWriter wraps the output with the writers registered by the setters.
+func wrapWriter(out io.Writer, writers []func(w io.Writer) io.Writer) io.Writer {
+	for _, wrap := range writers {
+		out = wrap(out)
+	}
+
+	return out
+}
+
+// output is the chain of writers around the output, shared by a logger and the loggers derived from it,
+// so that their records go through the same writers, e.g. the buffer of WithBufferedWriter.
+type output struct {
+	mu     sync.RWMutex
+	out    io.Writer
+	w      io.Writer
+	closed bool
+	// borrowed indicates that out is owned by another output, see borrow, so it is not closed
+	borrowed bool
+}
+
+// newOutput returns the output writing to out in the given format through the writers.
+func newOutput(out io.Writer, writers []func(w io.Writer) io.Writer, format string) *output {
+	return &output{
+		out: out,
+		w:   chainWriter(out, writers, format),
+	}
+}
+
+// chainWriter wraps the output with the writers, writing the records in the given format to out only,
+// so other writers such as WithTee still receive JSON.
+func chainWriter(out io.Writer, writers []func(w io.Writer) io.Writer, format string) io.Writer {
+	if format == FormatConsole {
+		return wrapWriter(newConsoleWriter(out, nil), writers)
+	}
+
+	return wrapWriter(out, writers)
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if o.closed {
+		return len(p), nil
+	}
+
+	return o.w.Write(p)
+}
+
+func (o *output) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if o.closed {
+		return len(p), nil
+	}
+
+	return writeLevel(o.w, level, p)
+}
+
+func (o *output) Flush() error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if o.closed {
+		return nil
+	}
+
+	return flushWriter(o.w)
+}
+
+// close flushes the chain and closes out if it implements io.Closer.
+// Further records are discarded by every logger sharing the output.
+func (o *output) close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return nil
+	}
+
+	o.closed = true
+	err := flushWriter(o.w)
+
+	if o.borrowed {
+		return err
+	}
+
+	if c, ok := o.out.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// borrow returns a new output writing to the same out in the given format through its own chain of writers.
+// It does not close out, and it is closed if o is.
+func (o *output) borrow(writers []func(w io.Writer) io.Writer, format string) *output {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return &output{
+		out:      o.out,
+		w:        chainWriter(o.out, writers, format),
+		closed:   o.closed,
+		borrowed: true,
+	}
+}
+
+// reset replaces the chain, once the records buffered by the current one are written.
+func (o *output) reset(out io.Writer, writers []func(w io.Writer) io.Writer, format string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	_ = flushWriter(o.w)
+
+	o.out = out
+	o.w = chainWriter(out, writers, format)
+}
+
+// swap is like reset, but returns the previous out so it can be closed once no record is written to it,
+// or nil if it is borrowed. A closed output is not reopened, in which case ok is false.
+func (o *output) swap(out io.Writer, writers []func(w io.Writer) io.Writer, format string) (prev io.Writer, ok bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return nil, false
+	}
+
+	_ = flushWriter(o.w)
+
+	if !o.borrowed {
+		prev = o.out
+	}
+
+	o.out = out
+	o.w = chainWriter(out, writers, format)
+	o.borrowed = false
+
+	return prev, true
+}
+
+// teeWriter writes all records to the primary writer and records above the threshold to the secondary one.
+type teeWriter struct {
+	primary   io.Writer
+	secondary io.Writer
+	minLevel  zerolog.Level
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	return w.primary.Write(p)
+}
+
+func (w *teeWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	n, err := writeLevel(w.primary, level, p)
+
+	if level >= w.minLevel && level != zerolog.NoLevel {
+		_, _ = w.secondary.Write(p)
+	}
+
+	return n, err
+}
+
+func (w *teeWriter) Flush() error {
+	if err := flushWriter(w.primary); err != nil {
+		return err
+	}
+
+	return flushWriter(w.secondary)
+}
+
+// multiWriter writes all records to each of the writers.
+type multiWriter []io.Writer
+
+func (w multiWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w multiWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var err error
+
+	for _, out := range w {
+		if _, e := writeLevel(out, level, p); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w multiWriter) Flush() error {
+	var err error
+
+	for _, out := range w {
+		if e := flushWriter(out); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// lineTransformer transforms each record before writing it to the underlying writer.
+type lineTransformer struct {
+	out io.Writer
+	fn  func(line []byte) []byte
+}
+
+func (w *lineTransformer) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *lineTransformer) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	line := p
+	newline := len(line) > 0 && line[len(line)-1] == '\n'
+
+	if newline {
+		line = line[:len(line)-1]
+	}
+
+	line = w.fn(line)
+
+	if newline {
+		line = append(line[:len(line):len(line)], '\n')
+	}
+
+	if _, err := writeLevel(w.out, level, line); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (w *lineTransformer) Flush() error {
+	return flushWriter(w.out)
+}
+
+// addNullError adds a null error field to the JSON record unless it has one at the top level.
+// Records that are not JSON objects are returned unchanged.
+func addNullError(line []byte) []byte {
+	end := bytes.LastIndexByte(line, '}')
+
+	if end < 0 || !missingField(line, zerolog.ErrorFieldName) {
+		return line
+	}
+
+	head := bytes.TrimRight(line[:end], " ")
+	out := make([]byte, 0, len(line)+len(zerolog.ErrorFieldName)+8)
+	out = append(out, head...)
+
+	if head[len(head)-1] != '{' {
+		out = append(out, ',')
+	}
+
+	out = append(out, '"')
+	out = append(out, zerolog.ErrorFieldName...)
+	out = append(out, `":null`...)
+
+	return append(out, line[end:]...)
+}
+
+// compactLevelNames maps the level names to the single characters used by WithCompactLevels.
+var compactLevelNames = map[string]string{
+	zerolog.TraceLevel.String(): "T",
+	zerolog.DebugLevel.String(): "D",
+	zerolog.InfoLevel.String():  "I",
+	zerolog.WarnLevel.String():  "W",
+	zerolog.ErrorLevel.String(): "E",
+	zerolog.FatalLevel.String(): "F",
+	zerolog.PanicLevel.String(): "P",
+}
+
+// compactLevel replaces the level of the record with a single character.
+// zerolog writes the level as the first field, so only the beginning of the record is checked.
+func compactLevel(line []byte) []byte {
+	prefix := `{"` + zerolog.LevelFieldName + `":"`
+
+	if !bytes.HasPrefix(line, []byte(prefix)) {
+		return line
+	}
+
+	end := bytes.IndexByte(line[len(prefix):], '"')
+
+	if end < 0 {
+		return line
+	}
+
+	abbr, found := compactLevelNames[string(line[len(prefix):len(prefix)+end])]
+
+	if !found {
+		return line
+	}
+
+	out := make([]byte, 0, len(line))
+	out = append(out, prefix...)
+	out = append(out, abbr...)
+
+	return append(out, line[len(prefix)+end:]...)
+}
+
+// sortFields returns the JSON record with its top-level fields sorted by key.
+// Records that are not JSON objects are returned unchanged.
+func sortFields(line []byte) []byte {
+	type field struct {
+		key   []byte
+		value json.RawMessage
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(line))
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return line
+	}
+
+	var fields []field
+
+	for dec.More() {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+
+		if err != nil {
+			return line
+		}
+
+		// keep the key as written, with its quotes and escapes
+		key := bytes.TrimLeft(line[offset:dec.InputOffset()], " ,")
+
+		var value json.RawMessage
+
+		if err := dec.Decode(&value); err != nil {
+			return line
+		}
+
+		if _, ok := tok.(string); !ok {
+			return line
+		}
+
+		fields = append(fields, field{key: key, value: value})
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool {
+		return bytes.Compare(fields[i].key, fields[j].key) < 0
+	})
+
+	out := make([]byte, 0, len(line))
+	out = append(out, '{')
+
+	for i, f := range fields {
+		if i > 0 {
+			out = append(out, ',')
+		}
+
+		out = append(out, f.key...)
+		out = append(out, ':')
+		out = append(out, f.value...)
+	}
+
+	return append(out, '}')
+}
+
+// missingField reports whether obj is a valid JSON object without the given key at the top level.
+func missingField(obj []byte, key string) bool {
+	dec := json.NewDecoder(bytes.NewReader(obj))
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return false
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+
+		if err != nil || tok == key {
+			return false
+		}
+
+		var value json.RawMessage
+
+		if err := dec.Decode(&value); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// fallbackWriter writes to the fallback writer when writing to the primary one fails.
+type fallbackWriter struct {
+	errors   uint64 // first field to be 64-bit aligned for atomic operations
+	primary  io.Writer
+	fallback io.Writer
+}
+
+func (w *fallbackWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (w *fallbackWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	n, err := writeLevel(w.primary, level, p)
+
+	if err == nil {
+		return n, nil
+	}
+
+	atomic.AddUint64(&w.errors, 1)
+
+	return writeLevel(w.fallback, level, p)
+}
+
+func (w *fallbackWriter) Errors() uint64 {
+	return atomic.LoadUint64(&w.errors)
+}
+
+func (w *fallbackWriter) Flush() error {
+	if err := flushWriter(w.primary); err != nil {
+		return err
+	}
+
+	return flushWriter(w.fallback)
+}
+
+// bufferedWriter is a buffered io.Writer safe for concurrent use.
+type bufferedWriter struct {
+	mu  sync.Mutex
+	buf *bufio.Writer
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.Write(p)
+}
+
+func (w *bufferedWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.Flush()
+}
+
+// flushWriter flushes the writer if it is buffered.
+func flushWriter(w io.Writer) error {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+func writeLevel(w io.Writer, level zerolog.Level, p []byte) (int, error) {
+	if lw, ok := w.(zerolog.LevelWriter); ok {
+		return lw.WriteLevel(level, p)
+	}
+
+	return w.Write(p)
+}
@@ -0,0 +1,72 @@
+package lecho_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/labstack/gommon/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ziflex/lecho/v3"
+)
+
+func TestLogger_WriterLevel(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	w := l.WriterLevel(log.ERROR)
+
+	n, err := io.WriteString(w, "foo\nbar\r\n\nbaz\n")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 14, n)
+	assert.Equal(
+		t,
+		`{"level":"error","message":"foo"}
+{"level":"error","message":"bar"}
+{"level":"error","message":"baz"}
+`,
+		b.String(),
+	)
+}
+
+func TestLogger_WriterLevel_Chunked(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	w := l.WriterLevel(log.INFO)
+
+	_, err := io.WriteString(w, "hello wo")
+	assert.NoError(t, err)
+	assert.Empty(t, b.String(), "should buffer the partial line")
+
+	_, err = io.WriteString(w, "rld\r\nfoo")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"level":"info","message":"hello world"}
+`, b.String())
+
+	assert.NoError(t, w.Close())
+	assert.Equal(
+		t,
+		`{"level":"info","message":"hello world"}
+{"level":"info","message":"foo"}
+`,
+		b.String(),
+		"should log the remainder on close",
+	)
+}
+
+func TestLogger_WriterLevel_LongLine(t *testing.T) {
+	b := &bytes.Buffer{}
+	l := lecho.New(b)
+
+	w := l.WriterLevel(log.INFO)
+	line := strings.Repeat("a", 64*1024+1)
+
+	_, err := io.WriteString(w, line)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"level":"info","message":"`+line+`"}
+`, b.String(), "should not buffer lines above the maximum size")
+}